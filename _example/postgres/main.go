@@ -1,7 +1,7 @@
 package main
 
 import (
-	"io"
+	"context"
 	"log"
 	"time"
 
@@ -36,11 +36,15 @@ func main() {
 
 	s.Start()
 
-	go func(s scheduler.Scheduler, store io.Closer) {
+	go func(s *scheduler.Scheduler) {
 		time.Sleep(time.Minute * 5)
-		// store.Close()
-		s.Stop()
-	}(s, storage)
+		// Running tasks get 30 seconds to finish, the store is closed afterwards.
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		defer cancel()
+		if err := s.Shutdown(ctx); err != nil {
+			log.Println(err)
+		}
+	}(s)
 
 	// Start a task without arguments and execute only once
 	if _, err := s.RunAfter(60*time.Second, TaskWithoutArgs); err != nil {
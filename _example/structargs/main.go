@@ -33,20 +33,20 @@ func CheckIfBirthday(person Person) {
 }
 
 func main() {
-	storage := storage.NewSqlite3Storage(
+	storage, err := storage.NewSqlite3Storage(
 		storage.Sqlite3Config{
 			DbName: "task_store.db",
 		},
 	)
-	if err := storage.Connect(); err != nil {
-		log.Fatal("Could not connect to db", err)
+	if err != nil {
+		log.Fatalf("Couldn't create scheduler storage : %v", err)
 	}
 
-	if err := storage.Initialize(); err != nil {
-		log.Fatal("Could not intialize database", err)
+	stubStorage := map[string]interface{}{
+		"main.CheckIfBirthday": CheckIfBirthday,
 	}
 
-	s := scheduler.New(storage)
+	s := scheduler.New(storage, stubStorage)
 
 	dob, _ := time.Parse(DateLayout, time.Now().Format(DateLayout))
 	person := Person{
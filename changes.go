@@ -0,0 +1,80 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/ClubNFT/scheduler/storage"
+	"github.com/ClubNFT/scheduler/task"
+)
+
+// subscribe applies the changes of tasks made by other schedulers sharing the store,
+// if it notifies about them, until the scheduler stops.
+func (scheduler *Scheduler) subscribe() error {
+	notifier, ok := scheduler.taskStore.store.(storage.ChangeNotifier)
+	if !ok {
+		return nil
+	}
+	changes, err := notifier.Subscribe(scheduler.dispatchCtx)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for change := range changes {
+			scheduler.applyChange(change)
+		}
+	}()
+	return nil
+}
+
+// applyChange updates the registered tasks after a stored task changed. The scheduler
+// is notified about its own changes as well, which are already applied.
+func (scheduler *Scheduler) applyChange(change storage.TaskChange) {
+	if change.Op == storage.TasksMissed {
+		scheduler.mu.Lock()
+		defer scheduler.mu.Unlock()
+		if err := scheduler.loadStoredTasks(); err != nil {
+			log.Printf("Error while loading tasks: %v", err)
+		}
+		return
+	}
+
+	// The changed task is fetched before locking, so that the store round trip
+	// doesn't hold up the scheduler.
+	taskID := task.ID(change.Hash)
+	var stored *task.Task
+	if change.Op != storage.TaskRemoved {
+		var err error
+		stored, err = scheduler.taskStore.FetchByHash(context.Background(), taskID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			log.Printf("Error while fetching changed task %s: %v", taskID, err)
+			return
+		}
+	}
+
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	registered, ok := scheduler.tasks[taskID]
+	_, queued := scheduler.queue.index[taskID]
+	switch {
+	case stored == nil && ok:
+		// Running tasks are left to finish, the runs waiting for a worker are dropped.
+		delete(scheduler.tasks, taskID)
+		delete(scheduler.queuedRuns, taskID)
+		scheduler.cancelWaiting(taskID)
+		scheduler.queue.remove(taskID)
+	case stored != nil && !ok && stored.DueAt().Before(scheduler.loadedUntil):
+		scheduler.registerTask(stored)
+	case stored != nil && ok && queued:
+		// Another scheduler ran the task, it's rescheduled the way that one did.
+		registered.LastRun = stored.LastRun
+		registered.NextRun = stored.NextRun
+		registered.Attempt = stored.Attempt
+		registered.RetryAt = stored.RetryAt
+		scheduler.queue.schedule(registered)
+	default:
+		return
+	}
+	scheduler.wake()
+}
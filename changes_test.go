@@ -0,0 +1,145 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/config"
+	"github.com/ClubNFT/scheduler/storage"
+)
+
+// notifyingStore notifies every subscriber about the changes of a dueStore shared
+// by several schedulers.
+type notifyingStore struct {
+	*dueStore
+	mu          sync.Mutex
+	subscribers []chan storage.TaskChange
+}
+
+func (store *notifyingStore) notify(op storage.TaskChangeOp, hash string) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	for _, subscriber := range store.subscribers {
+		subscriber <- storage.TaskChange{Op: op, Hash: hash}
+	}
+}
+
+func (store *notifyingStore) Add(ctx context.Context, attributes storage.TaskAttributes) error {
+	err := store.dueStore.Add(ctx, attributes)
+	if err == nil {
+		store.notify(storage.TaskAdded, attributes.Hash)
+	}
+	return err
+}
+
+func (store *notifyingStore) Update(ctx context.Context, attributes storage.TaskAttributes) error {
+	err := store.dueStore.Update(ctx, attributes)
+	if err == nil {
+		store.notify(storage.TaskUpdated, attributes.Hash)
+	}
+	return err
+}
+
+func (store *notifyingStore) Remove(ctx context.Context, attributes storage.TaskAttributes) error {
+	err := store.dueStore.Remove(ctx, attributes)
+	if err == nil {
+		store.notify(storage.TaskRemoved, attributes.Hash)
+	}
+	return err
+}
+
+func (store *notifyingStore) Subscribe(ctx context.Context) (<-chan storage.TaskChange, error) {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	changes := make(chan storage.TaskChange, 100)
+	store.subscribers = append(store.subscribers, changes)
+	return changes, nil
+}
+
+func waitForTaskCount(t *testing.T, scheduler *Scheduler, expected int, message string) {
+	t.Helper()
+	deadline := time.Now().Add(time.Second)
+	for taskCount(scheduler) != expected && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if taskCount(scheduler) != expected {
+		t.Error(message)
+	}
+}
+
+func TestChangesOfOtherSchedulersAreApplied(t *testing.T) {
+	store := &notifyingStore{dueStore: newDueStore()}
+	stubs := config.StubMapping{mockFunctionName: mockFunction}
+	first := New(store, stubs)
+	second := New(store, stubs)
+	for _, scheduler := range []*Scheduler{first, second} {
+		if err := scheduler.Start(); err != nil {
+			t.Fatal("Failed to start scheduler: ", err)
+		}
+		t.Cleanup(scheduler.Stop)
+	}
+
+	taskID, err := first.RunAfter(10*time.Second, mockFunction, "shared")
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	waitForTaskCount(t, second, 1, "A task added by another scheduler should be registered")
+
+	nextRun := time.Now().Add(20 * time.Second).Truncate(time.Second)
+	first.mu.Lock()
+	first.tasks[taskID].NextRun = nextRun
+	_ = first.taskStore.Update(context.Background(), first.tasks[taskID])
+	first.mu.Unlock()
+	deadline := time.Now().Add(time.Second)
+	for time.Now().Before(deadline) {
+		second.mu.Lock()
+		updated := second.tasks[taskID].NextRun.Equal(nextRun)
+		second.mu.Unlock()
+		if updated {
+			break
+		}
+		time.Sleep(time.Millisecond)
+	}
+	second.mu.Lock()
+	if !second.tasks[taskID].NextRun.Equal(nextRun) {
+		t.Error("A task rescheduled by another scheduler should be rescheduled")
+	}
+	second.mu.Unlock()
+
+	if err := first.Cancel(taskID); err != nil {
+		t.Fatal("Cancelling a task should succeed: ", err)
+	}
+	waitForTaskCount(t, second, 0, "A task cancelled by another scheduler should be removed")
+}
+
+func TestRemovedTaskDoesNotWaitForAWorker(t *testing.T) {
+	tracker := newRunTracker()
+	scheduler := startScheduler(t, &lockedStore{t: t}, mockStubs(tracker.run), WithMaxConcurrency(1, 1))
+
+	now := time.Now()
+	if _, err := scheduler.RunAt(now, tracker.run, "running"); err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	waiting, err := scheduler.RunAt(now, tracker.run, "waiting")
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	tracker.waitForCalls(1)
+	time.Sleep(20 * time.Millisecond)
+
+	// Another scheduler removed the task while its run waits for a worker.
+	scheduler.applyChange(storage.TaskChange{Op: storage.TaskRemoved, Hash: string(waiting)})
+	if stats := scheduler.PoolStats(); stats.Queued != 0 {
+		t.Errorf("The run of the removed task should leave the queue, got %+v", stats)
+	}
+	close(tracker.release)
+	time.Sleep(50 * time.Millisecond)
+	if calls, _ := tracker.counts(); calls != 1 {
+		t.Errorf("The run of the removed task should not start, ran %d tasks", calls)
+	}
+	if taskCount(scheduler) != 0 {
+		t.Error("The removed task should be unregistered")
+	}
+}
@@ -0,0 +1,113 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/config"
+	"github.com/ClubNFT/scheduler/storage"
+	"github.com/ClubNFT/scheduler/task"
+)
+
+// lockedStore is a minimal TaskStore which fails the test if it's used concurrently.
+type lockedStore struct {
+	busy int32
+	t    *testing.T
+}
+
+func (store *lockedStore) enter() func() {
+	if !atomic.CompareAndSwapInt32(&store.busy, 0, 1) {
+		store.t.Error("Task store used concurrently")
+	}
+	return func() { atomic.StoreInt32(&store.busy, 0) }
+}
+
+func (store *lockedStore) Add(context.Context, storage.TaskAttributes) error {
+	defer store.enter()()
+	return nil
+}
+
+func (store *lockedStore) Update(context.Context, storage.TaskAttributes) error {
+	defer store.enter()()
+	return nil
+}
+
+func (store *lockedStore) Remove(context.Context, storage.TaskAttributes) error {
+	defer store.enter()()
+	return nil
+}
+
+func (store *lockedStore) Close() error { return nil }
+
+func (store *lockedStore) Fetch(context.Context) ([]storage.TaskAttributes, error) {
+	defer store.enter()()
+	return nil, nil
+}
+
+var concurrentCalls int32
+
+func countCall(id string) {
+	atomic.AddInt32(&concurrentCalls, 1)
+}
+
+func TestConcurrentScheduling(t *testing.T) {
+	scheduler := New(&lockedStore{t: t}, config.StubMapping{
+		"github.com/ClubNFT/scheduler.countCall": countCall,
+	})
+	if err := scheduler.Start(); err != nil {
+		t.Fatal("Failed to start scheduler: ", err)
+	}
+	defer scheduler.Stop()
+
+	var wg sync.WaitGroup
+	ids := make(chan task.ID, 400)
+	for worker := 0; worker < 4; worker++ {
+		wg.Add(1)
+		go func(worker int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				id := string(rune('a'+worker)) + time.Now().String()
+				var taskID task.ID
+				var err error
+				switch i % 3 {
+				case 0:
+					taskID, err = scheduler.RunAt(time.Now(), countCall, id)
+				case 1:
+					taskID, err = scheduler.RunAfter(time.Millisecond, countCall, id)
+				default:
+					taskID, err = scheduler.RunEvery(time.Millisecond, countCall, id)
+				}
+				if err != nil {
+					t.Error("Scheduling should not fail: ", err)
+					return
+				}
+				ids <- taskID
+			}
+		}(worker)
+	}
+
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 100; i++ {
+			_ = scheduler.Cancel(<-ids)
+		}
+	}()
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			_ = scheduler.Refresh()
+			time.Sleep(time.Millisecond)
+		}
+		scheduler.Clear()
+	}()
+	wg.Wait()
+
+	time.Sleep(20 * time.Millisecond)
+	if atomic.LoadInt32(&concurrentCalls) == 0 {
+		t.Error("Tasks should have been executed while scheduling")
+	}
+}
@@ -1,7 +1,9 @@
 package config
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"reflect"
 )
 
@@ -11,22 +13,76 @@ type FunctionManager struct {
 	stubStorage StubMapping
 }
 
+var (
+	contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+	errorType   = reflect.TypeOf((*error)(nil)).Elem()
+)
+
 func NewFunctionManager(stubStorage StubMapping) *FunctionManager {
 	return &FunctionManager{stubStorage: stubStorage}
 }
 
+// Get returns the function registered as funcName.
+func (m *FunctionManager) Get(funcName string) (interface{}, bool) {
+	function, ok := m.stubStorage[funcName]
+	return function, ok
+}
+
 func (m *FunctionManager) Call(funcName string, params ...interface{}) (result interface{}, err error) {
+	return m.CallContext(context.Background(), funcName, params...)
+}
+
+// CallContext calls the function registered as funcName. Functions whose first
+// parameter is a context.Context receive ctx in front of params. If the last
+// result of the function is an error, it's returned as err. The variadic params of a
+// variadic function are passed together as a slice, the last one of params. Any other result is
+// returned as result, or as a []interface{} if the function has several.
+func (m *FunctionManager) CallContext(ctx context.Context, funcName string, params ...interface{}) (result interface{}, err error) {
 	f := reflect.ValueOf(m.stubStorage[funcName])
+	if !f.IsValid() || f.Kind() != reflect.Func || f.IsNil() {
+		err = fmt.Errorf("Function %s is not registered in the stub mapping", funcName)
+		return
+	}
+	if f.Type().NumIn() > 0 && f.Type().In(0) == contextType {
+		params = append([]interface{}{ctx}, params...)
+	}
 	if len(params) != f.Type().NumIn() {
 		err = errors.New("The number of params is out of index.")
 		return
 	}
 	in := make([]reflect.Value, len(params))
 	for k, param := range params {
+		if param == nil {
+			in[k] = reflect.Zero(f.Type().In(k))
+			continue
+		}
 		in[k] = reflect.ValueOf(param)
 	}
 
-	_ = f.Call(in)
-	//result = res[0].Interface()
+	// The variadic params of a variadic function are passed as a slice, which is
+	// what its last parameter type expects.
+	var res []reflect.Value
+	if f.Type().IsVariadic() {
+		res = f.CallSlice(in)
+	} else {
+		res = f.Call(in)
+	}
+	if n := len(res); n > 0 && f.Type().Out(n-1) == errorType {
+		if !res[n-1].IsNil() {
+			err = res[n-1].Interface().(error)
+		}
+		res = res[:n-1]
+	}
+	switch len(res) {
+	case 0:
+	case 1:
+		result = res[0].Interface()
+	default:
+		results := make([]interface{}, len(res))
+		for i, value := range res {
+			results[i] = value.Interface()
+		}
+		result = results
+	}
 	return
 }
@@ -0,0 +1,101 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ClubNFT/scheduler/storage"
+	"github.com/ClubNFT/scheduler/task"
+)
+
+// leads reports whether the scheduler runs tasks. With leader election enabled,
+// only the leader runs them. The scheduler's lock must be held by the caller.
+func (scheduler *Scheduler) leads() bool {
+	return scheduler.electionInterval == 0 || scheduler.leading
+}
+
+// elect tries to make the scheduler the leader, and calls the leadership hooks if
+// that changed. The leader loads the tasks which were scheduled by standbys.
+func (scheduler *Scheduler) elect() {
+	if scheduler.dispatchCtx.Err() != nil {
+		// The scheduler is stopping and resigns, it must not lead again.
+		return
+	}
+	// The store is asked without holding the lock, so that scheduling tasks doesn't
+	// wait for it. It's given up on once the next election is due.
+	elector := scheduler.taskStore.store.(storage.LeaderElector)
+	ctx, cancel := context.WithTimeout(context.Background(), scheduler.electionInterval)
+	leading, err := elector.TryLead(ctx)
+	cancel()
+	if err != nil {
+		log.Printf("Error while electing the leader: %v", err)
+		leading = false
+	}
+
+	scheduler.mu.Lock()
+	if scheduler.dispatchCtx.Err() != nil {
+		// The scheduler began stopping meanwhile. Shutdown only resigns the
+		// leadership it knows about, one which was just won is resigned here.
+		won := leading && !scheduler.leading
+		scheduler.mu.Unlock()
+		if won {
+			ctx, cancel := context.WithTimeout(context.Background(), scheduler.electionInterval)
+			defer cancel()
+			if err := elector.Resign(ctx); err != nil {
+				log.Printf("Error while resigning as leader: %v", err)
+			}
+		}
+		return
+	}
+	changed := leading != scheduler.leading
+	scheduler.leading = leading
+
+	if leading {
+		if changed {
+			// The previous leader ran and rescheduled tasks, so they're all loaded
+			// again from the store.
+			scheduler.tasks = make(map[task.ID]*task.Task)
+			scheduler.queue = newTaskQueue()
+			scheduler.loadedUntil = time.Time{}
+		}
+		if err := scheduler.loadStoredTasks(); err != nil {
+			log.Printf("Error while loading tasks: %v", err)
+		}
+	}
+	scheduler.mu.Unlock()
+
+	if changed {
+		scheduler.wake()
+		scheduler.reportLeadership(leading)
+	}
+}
+
+// loadStoredTasks registers the stored tasks which aren't registered yet.
+// The scheduler's lock must be held by the caller.
+func (scheduler *Scheduler) loadStoredTasks() error {
+	if _, ok := scheduler.taskStore.dueStore(); ok {
+		return scheduler.loadDueTasks(time.Now())
+	}
+	return scheduler.populateTasks()
+}
+
+// resign ends the scheduler's leadership when it stops, and reports whether it led.
+// The scheduler's lock must be held by the caller.
+func (scheduler *Scheduler) resign() bool {
+	if scheduler.electionInterval == 0 || !scheduler.leading {
+		return false
+	}
+	elector := scheduler.taskStore.store.(storage.LeaderElector)
+	if err := elector.Resign(context.Background()); err != nil {
+		log.Printf("Error while resigning as leader: %v", err)
+	}
+	scheduler.leading = false
+	return true
+}
+
+func (scheduler *Scheduler) reportLeadership(leading bool) {
+	for _, hook := range scheduler.leadershipHooks {
+		hook(leading)
+	}
+}
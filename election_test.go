@@ -0,0 +1,213 @@
+package scheduler
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/config"
+	"github.com/ClubNFT/scheduler/storage"
+)
+
+// election is the leadership shared by the electorStores of several schedulers.
+type election struct {
+	mu     sync.Mutex
+	leader *electorStore
+}
+
+// electorStore shares a MemoryStorage and an election with other schedulers.
+type electorStore struct {
+	*storage.MemoryStorage
+	election *election
+}
+
+func (store *electorStore) TryLead(context.Context) (bool, error) {
+	store.election.mu.Lock()
+	defer store.election.mu.Unlock()
+	if store.election.leader == nil {
+		store.election.leader = store
+	}
+	return store.election.leader == store, nil
+}
+
+func (store *electorStore) Resign(context.Context) error {
+	store.election.mu.Lock()
+	defer store.election.mu.Unlock()
+	if store.election.leader == store {
+		store.election.leader = nil
+	}
+	return nil
+}
+
+func newElectingScheduler(t *testing.T, store *electorStore, counter *callCounter, leadership chan<- bool) *Scheduler {
+	return startScheduler(t, store, mockStubs(counter.count), WithLeaderElection(10*time.Millisecond),
+		WithLeadershipHook(func(leading bool) {
+			leadership <- leading
+		}))
+}
+
+func expectLeadership(t *testing.T, leadership <-chan bool, expected bool, message string) {
+	t.Helper()
+	select {
+	case leading := <-leadership:
+		if leading != expected {
+			t.Error(message)
+		}
+	case <-time.After(time.Second):
+		t.Fatal(message)
+	}
+}
+
+func TestLeaderElection(t *testing.T) {
+	counter := &callCounter{}
+	memStore := storage.NewMemoryStorage()
+	shared := &election{}
+	firstLeadership := make(chan bool, 2)
+	secondLeadership := make(chan bool, 2)
+	first := newElectingScheduler(t, &electorStore{MemoryStorage: memStore, election: shared}, counter, firstLeadership)
+	expectLeadership(t, firstLeadership, true, "The first scheduler should become the leader")
+	second := newElectingScheduler(t, &electorStore{MemoryStorage: memStore, election: shared}, counter, secondLeadership)
+
+	if _, err := second.RunAfter(20*time.Millisecond, counter.count); err != nil {
+		t.Fatal("A standby should accept tasks: ", err)
+	}
+	deadline := time.Now().Add(time.Second)
+	for counter.Calls() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond)
+	if calls := counter.Calls(); calls != 1 {
+		t.Errorf("The task scheduled by the standby should run once on the leader, ran %d times", calls)
+	}
+
+	first.Stop()
+	expectLeadership(t, firstLeadership, false, "The leader should stop leading when it stops")
+	expectLeadership(t, secondLeadership, true, "The standby should take over once the leader stopped")
+}
+
+func TestLeaderElectionRequiresElector(t *testing.T) {
+	scheduler := New(storage.NewMemoryStorage(), config.StubMapping{}, WithLeaderElection(time.Second))
+	if err := scheduler.Start(); err == nil {
+		t.Error("Starting leader election with a store which can't elect a leader should fail")
+	}
+}
+
+// blockingElectorStore blocks electing the leader while it's blocked, and reports
+// the elections which are blocked on electing.
+type blockingElectorStore struct {
+	*electorStore
+	electing chan struct{}
+
+	mu      sync.Mutex
+	release chan struct{}
+}
+
+func newBlockingElectorStore(store *electorStore) *blockingElectorStore {
+	release := make(chan struct{})
+	close(release)
+	return &blockingElectorStore{electorStore: store, electing: make(chan struct{}, 1), release: release}
+}
+
+func (store *blockingElectorStore) block() {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.release = make(chan struct{})
+}
+
+func (store *blockingElectorStore) unblock() {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	close(store.release)
+}
+
+func (store *blockingElectorStore) TryLead(ctx context.Context) (bool, error) {
+	store.mu.Lock()
+	release := store.release
+	store.mu.Unlock()
+	select {
+	case <-release:
+	default:
+		// Only the elections which are blocked are reported.
+		select {
+		case store.electing <- struct{}{}:
+		default:
+		}
+		<-release
+	}
+	return store.electorStore.TryLead(ctx)
+}
+
+func TestElectingDoesNotBlockScheduling(t *testing.T) {
+	counter := &callCounter{}
+	store := newBlockingElectorStore(&electorStore{MemoryStorage: storage.NewMemoryStorage(), election: &election{}})
+	leadership := make(chan bool, 2)
+	scheduler := startScheduler(t, store, mockStubs(counter.count), WithLeaderElection(10*time.Millisecond),
+		WithLeadershipHook(func(leading bool) {
+			leadership <- leading
+		}))
+	expectLeadership(t, leadership, true, "The scheduler should become the leader")
+
+	store.block()
+	defer store.unblock()
+	select {
+	case <-store.electing:
+	case <-time.After(time.Second):
+		t.Fatal("The leader should be elected again")
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := scheduler.RunAfter(time.Hour, counter.count); err != nil {
+			t.Error("Creating a task should succeed: ", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Scheduling tasks should not wait for the store to elect the leader")
+	}
+}
+
+func TestLeadershipWonWhileStoppingIsResigned(t *testing.T) {
+	counter := &callCounter{}
+	memStore := storage.NewMemoryStorage()
+	shared := &election{}
+	firstLeadership := make(chan bool, 2)
+	first := newElectingScheduler(t, &electorStore{MemoryStorage: memStore, election: shared}, counter, firstLeadership)
+	expectLeadership(t, firstLeadership, true, "The first scheduler should become the leader")
+	store := newBlockingElectorStore(&electorStore{MemoryStorage: memStore, election: shared})
+	secondLeadership := make(chan bool, 2)
+	second := startScheduler(t, store, mockStubs(counter.count), WithLeaderElection(10*time.Millisecond),
+		WithLeadershipHook(func(leading bool) {
+			secondLeadership <- leading
+		}))
+
+	// The standby is still electing when the leader stopped and it begins stopping.
+	store.block()
+	<-store.electing
+	first.Stop()
+	stopped := make(chan struct{})
+	go func() {
+		second.Stop()
+		close(stopped)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	store.unblock()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("The standby should stop")
+	}
+
+	shared.mu.Lock()
+	defer shared.mu.Unlock()
+	if shared.leader != nil {
+		t.Error("The leadership won while stopping should be resigned")
+	}
+	select {
+	case <-secondLeadership:
+		t.Error("The standby should not report the leadership it won while stopping")
+	default:
+	}
+}
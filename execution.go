@@ -0,0 +1,192 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ClubNFT/scheduler/task"
+)
+
+// Execution describes a completed run of a task.
+type Execution struct {
+	TaskID task.ID
+	Func   string
+	Params []task.Param
+	// ScheduledAt is the time the run was due, StartedAt and FinishedAt
+	// the times the function was called and returned.
+	ScheduledAt time.Time
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	// Attempt is 1 for the first attempt of a run and grows with every retry.
+	Attempt int
+	// Result holds the values returned by the function, apart from a trailing
+	// error, see config.FunctionManager.CallContext.
+	Result interface{}
+	// Err is the error returned by the function or a *task.PanicError.
+	Err error
+}
+
+// activeRun is a single in-flight run of a task.
+type activeRun struct {
+	cancel    context.CancelFunc
+	execution Execution
+}
+
+// execute starts a run of the task, or queues it until a worker is free, see
+// WithMaxConcurrency. The context passed to the task is cancelled when the
+// scheduler stops or the task is cancelled.
+// The scheduler's lock must be held by the caller.
+func (scheduler *Scheduler) execute(t *task.Task, scheduledAt time.Time) {
+	ctx, cancel := context.WithCancel(scheduler.ctx)
+	pending := &pendingRun{task: t, scheduledAt: scheduledAt, ctx: ctx, cancel: cancel}
+	pending.stopRenewing = scheduler.renewLease(t.Hash(), ctx, cancel)
+	if scheduler.pool.canStart(t.Func.Name) {
+		scheduler.start(pending)
+		return
+	}
+	scheduler.pool.waiting = append(scheduler.pool.waiting, pending)
+}
+
+// start runs the task in its own goroutine. Once the execution completes, the
+// task is finished or retried, the runs waiting for its worker are started and
+// the execution hooks are called.
+// The scheduler's lock must be held by the caller.
+func (scheduler *Scheduler) start(pending *pendingRun) {
+	t := pending.task
+	taskID := t.Hash()
+	record := Execution{
+		TaskID:      taskID,
+		Func:        t.Func.Name,
+		Params:      t.Params,
+		ScheduledAt: pending.scheduledAt,
+		StartedAt:   time.Now(),
+		Attempt:     t.Attempt + 1,
+	}
+	run := &activeRun{cancel: pending.cancel, execution: record}
+	if scheduler.running[taskID] == nil {
+		scheduler.running[taskID] = make(map[*activeRun]struct{})
+	}
+	scheduler.running[taskID][run] = struct{}{}
+	scheduler.pool.acquire(t.Func.Name)
+
+	scheduler.inflight.Add(1)
+	go func() {
+		defer scheduler.inflight.Done()
+		record.Result, record.Err = t.RunContext(pending.ctx)
+		record.FinishedAt = time.Now()
+		pending.stopRenewing()
+		pending.cancel()
+
+		// Runs which return after the task store was closed aren't recorded.
+		scheduler.closing.RLock()
+		if open := scheduler.complete(&completedRun{task: t, run: run, err: record.Err}); open {
+			scheduler.recordExecution(t, record)
+		}
+		scheduler.closing.RUnlock()
+		// Due tasks which were held back while the pool was saturated can be
+		// dispatched now.
+		scheduler.wake()
+
+		for _, hook := range scheduler.executionHooks {
+			hook(record)
+		}
+	}()
+}
+
+// completedRun is a run whose execution returned and which waits to be finished, see
+// complete.
+type completedRun struct {
+	task *task.Task
+	run  *activeRun
+	err  error
+	// open reports whether the task store was still open once the run finished.
+	open bool
+	done chan struct{}
+}
+
+// complete finishes the run and returns once it's finished, reporting whether the task
+// store was still open. Runs which complete while another one waits for the scheduler's
+// lock are finished along with it, so that frequent runs don't pile up waiting for the
+// lock one by one.
+func (scheduler *Scheduler) complete(completed *completedRun) bool {
+	completed.done = make(chan struct{})
+	scheduler.completedMu.Lock()
+	first := len(scheduler.completed) == 0
+	scheduler.completed = append(scheduler.completed, completed)
+	scheduler.completedMu.Unlock()
+	if !first {
+		<-completed.done
+		return completed.open
+	}
+
+	scheduler.mu.Lock()
+	scheduler.completedMu.Lock()
+	batch := scheduler.completed
+	scheduler.completed = nil
+	scheduler.completedMu.Unlock()
+	for _, completed := range batch {
+		taskID := completed.run.execution.TaskID
+		delete(scheduler.running[taskID], completed.run)
+		if len(scheduler.running[taskID]) == 0 {
+			delete(scheduler.running, taskID)
+		}
+		scheduler.pool.release(completed.task.Func.Name)
+		completed.open = !scheduler.closed
+		if completed.open {
+			scheduler.finish(completed.task, completed.err)
+			// The queued run keeps the lease of the one which finished.
+			scheduler.runQueued(taskID)
+			scheduler.releaseLease(taskID)
+		}
+	}
+	if !scheduler.closed {
+		scheduler.startWaiting()
+	}
+	scheduler.mu.Unlock()
+	for _, completed := range batch {
+		close(completed.done)
+	}
+	return completed.open
+}
+
+// finish updates the state of a task after one of its executions completed.
+// Failed executions are retried according to the task's retry policy, and
+// one-off tasks are removed once they succeeded or ran out of attempts.
+// The scheduler's lock must be held by the caller.
+func (scheduler *Scheduler) finish(t *task.Task, err error) {
+	taskID := t.Hash()
+	if scheduler.tasks[taskID] != t {
+		// The task was cancelled or replaced while it was running.
+		return
+	}
+
+	if err != nil && t.ScheduleRetry(time.Now()) {
+		log.Printf("Retrying function %s at %s (attempt %d of %d)",
+			t.Func.Name, t.RetryAt.Format(time.RFC3339), t.Attempt+1, t.Retry.MaxAttempts)
+		scheduler.queue.schedule(t)
+		_ = scheduler.taskStore.Update(context.Background(), t)
+		scheduler.wake()
+		return
+	}
+
+	if !t.IsRecurring {
+		_ = scheduler.taskStore.Remove(context.Background(), t)
+		delete(scheduler.tasks, taskID)
+		return
+	}
+	if t.Attempt > 0 {
+		t.ResetRetry()
+		_ = scheduler.taskStore.Update(context.Background(), t)
+	}
+}
+
+// cancelRunning cancels the context of every in-flight run of the task and
+// reports whether there were any. The scheduler's lock must be held by the caller.
+func (scheduler *Scheduler) cancelRunning(taskID task.ID) bool {
+	executions, found := scheduler.running[taskID]
+	for run := range executions {
+		run.cancel()
+	}
+	return found
+}
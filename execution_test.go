@@ -0,0 +1,258 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/config"
+	"github.com/ClubNFT/scheduler/task"
+)
+
+// blocker reports the contexts of the runs of block, which return once they're
+// cancelled.
+type blocker struct {
+	calls chan context.Context
+}
+
+func newBlocker() *blocker {
+	return &blocker{calls: make(chan context.Context, 1)}
+}
+
+func (blocker *blocker) block(ctx context.Context) {
+	blocker.calls <- ctx
+	<-ctx.Done()
+}
+
+func newBlockingScheduler(t *testing.T, blocker *blocker) *Scheduler {
+	return startScheduler(t, &lockedStore{t: t}, mockStubs(blocker.block))
+}
+
+func taskCount(scheduler *Scheduler) int {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	return len(scheduler.tasks)
+}
+
+func waitForCancel(t *testing.T, ctx context.Context) {
+	select {
+	case <-ctx.Done():
+	case <-time.After(time.Second):
+		t.Fatal("The context of the running task should have been cancelled")
+	}
+}
+
+func TestCancelRunningTask(t *testing.T) {
+	blocker := newBlocker()
+	scheduler := newBlockingScheduler(t, blocker)
+	taskID, err := scheduler.RunAt(time.Now(), blocker.block)
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+
+	ctx := <-blocker.calls
+	if err := scheduler.Cancel(taskID); err != nil {
+		t.Error("Cancelling a running task should not fail: ", err)
+	}
+	waitForCancel(t, ctx)
+}
+
+func TestStopCancelsRunningTasks(t *testing.T) {
+	blocker := newBlocker()
+	scheduler := newBlockingScheduler(t, blocker)
+	if _, err := scheduler.RunAt(time.Now(), blocker.block); err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+
+	ctx := <-blocker.calls
+	go scheduler.Stop()
+	waitForCancel(t, ctx)
+}
+
+func TestTaskTimeout(t *testing.T) {
+	blocker := newBlocker()
+	scheduler := newBlockingScheduler(t, blocker)
+	_, err := scheduler.With(WithTimeout(10*time.Millisecond)).RunAt(time.Now(), blocker.block)
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+
+	ctx := <-blocker.calls
+	waitForCancel(t, ctx)
+	if ctx.Err() != context.DeadlineExceeded {
+		t.Error("The task should have timed out, got: ", ctx.Err())
+	}
+}
+
+func TestFinishRetriesFailedRun(t *testing.T) {
+	blocker := newBlocker()
+	scheduler := newBlockingScheduler(t, blocker)
+
+	taskID, err := scheduler.With(WithRetry(task.RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: time.Hour,
+	})).RunAt(time.Now().Add(time.Hour), blocker.block)
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	failed := scheduler.tasks[taskID]
+	for attempt := 1; attempt < 3; attempt++ {
+		scheduler.finish(failed, errors.New("failed"))
+		if failed.Attempt != attempt || failed.RetryAt.IsZero() || scheduler.tasks[taskID] != failed {
+			t.Fatalf("Failure %d should schedule a retry, got attempt %d", attempt, failed.Attempt)
+		}
+	}
+	scheduler.finish(failed, errors.New("failed"))
+	if _, found := scheduler.tasks[taskID]; found {
+		t.Error("The task should be removed once it ran out of attempts")
+	}
+}
+
+// fail fails every call.
+func (counter *callCounter) fail() error {
+	counter.count()
+	return errors.New("failed")
+}
+
+// failTwice fails the first two calls.
+func (counter *callCounter) failTwice() error {
+	if atomic.AddInt32(&counter.calls, 1) <= 2 {
+		return errors.New("failed")
+	}
+	return nil
+}
+
+// panicOnce panics on the first call.
+func (counter *callCounter) panicOnce() {
+	if atomic.AddInt32(&counter.calls, 1) == 1 {
+		panic("failed")
+	}
+}
+
+func TestRetryFailedTask(t *testing.T) {
+	failing := &callCounter{}
+	panicking := &callCounter{}
+	for _, function := range []task.Function{failing.failTwice, panicking.panicOnce} {
+		scheduler := startScheduler(t, &lockedStore{t: t}, mockStubs(function))
+		_, err := scheduler.With(WithRetry(task.RetryPolicy{
+			MaxAttempts:  5,
+			InitialDelay: time.Millisecond,
+			Multiplier:   2,
+		})).RunAt(time.Now(), function)
+		if err != nil {
+			t.Fatal("Creating a task should succeed: ", err)
+		}
+
+		deadline := time.Now().Add(time.Second)
+		for taskCount(scheduler) > 0 && time.Now().Before(deadline) {
+			time.Sleep(time.Millisecond)
+		}
+		if taskCount(scheduler) != 0 {
+			t.Error("The task should be removed once a retry succeeded")
+		}
+		scheduler.Stop()
+	}
+	if failing.Calls() != 3 || panicking.Calls() != 2 {
+		t.Errorf("The task should not run again after succeeding, ran %d and %d times",
+			failing.Calls(), panicking.Calls())
+	}
+}
+
+func TestRetryGivesUp(t *testing.T) {
+	counter := &callCounter{}
+	scheduler := startScheduler(t, &lockedStore{t: t}, mockStubs(counter.fail))
+	_, err := scheduler.With(WithRetry(task.RetryPolicy{
+		MaxAttempts:  3,
+		InitialDelay: time.Millisecond,
+	})).RunAt(time.Now(), counter.fail)
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if calls := counter.Calls(); calls != 3 {
+		t.Errorf("The task should have been attempted 3 times, got %d", calls)
+	}
+	if taskCount(scheduler) != 0 {
+		t.Error("The task should be removed once it ran out of attempts")
+	}
+}
+
+func TestSchedulerSurvivesPanic(t *testing.T) {
+	counter := &callCounter{}
+	scheduler := startScheduler(t, &lockedStore{t: t}, mockStubs(panickingTask, counter.count))
+	if _, err := scheduler.RunAt(time.Now(), panickingTask); err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	if _, err := scheduler.RunAfter(20*time.Millisecond, counter.count); err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for counter.Calls() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if counter.Calls() != 1 {
+		t.Fatal("Tasks should still run after a task panicked")
+	}
+}
+
+func panickingTask() {
+	var callback func()
+	callback()
+}
+
+func computeAnswer(question string) (int, error) {
+	if question == "" {
+		return 0, errors.New("no question")
+	}
+	return 42, nil
+}
+
+func TestExecutionHook(t *testing.T) {
+	executions := make(chan Execution, 2)
+	scheduler := New(&lockedStore{t: t}, config.StubMapping{
+		"github.com/ClubNFT/scheduler.computeAnswer": computeAnswer,
+	}, WithExecutionHook(func(execution Execution) {
+		executions <- execution
+	}))
+	if err := scheduler.Start(); err != nil {
+		t.Fatal("Failed to start scheduler: ", err)
+	}
+	defer scheduler.Stop()
+
+	scheduledAt := time.Now()
+	if _, err := scheduler.RunAt(scheduledAt, computeAnswer, "everything"); err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	if _, err := scheduler.RunAt(scheduledAt, computeAnswer, ""); err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		select {
+		case execution := <-executions:
+			if !execution.ScheduledAt.Equal(scheduledAt) || execution.Attempt != 1 ||
+				execution.StartedAt.Before(scheduledAt) || execution.FinishedAt.Before(execution.StartedAt) {
+				t.Errorf("Unexpected execution times: %+v", execution)
+			}
+			switch execution.Params[0] {
+			case "everything":
+				if execution.Result != 42 || execution.Err != nil {
+					t.Errorf("Unexpected execution outcome: %+v", execution)
+				}
+			default:
+				if execution.Err == nil {
+					t.Error("The error returned by the function should be reported")
+				}
+			}
+		case <-time.After(time.Second):
+			t.Fatal("The execution hook should have been called")
+		}
+	}
+}
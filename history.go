@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ClubNFT/scheduler/storage"
+	"github.com/ClubNFT/scheduler/task"
+)
+
+// maxHistoryPruneInterval is the longest time between two prunings of the history.
+const maxHistoryPruneInterval = time.Hour
+
+// WithHistory records every run of a task in history, see Scheduler.History.
+func WithHistory(history storage.HistoryStore) Option {
+	return func(scheduler *Scheduler) {
+		scheduler.history = history
+	}
+}
+
+// WithHistoryRetention removes the recorded runs once they're older than retention.
+// The history is pruned every retention, but at least once an hour.
+func WithHistoryRetention(retention time.Duration) Option {
+	return func(scheduler *Scheduler) {
+		scheduler.historyRetention = retention
+	}
+}
+
+// History returns the recorded runs of the task which match filter, the latest run
+// first. Their Err holds the text of the error they failed with, and their Result
+// isn't recorded. It requires WithHistory.
+func (scheduler *Scheduler) History(taskID task.ID, filter storage.HistoryFilter) ([]Execution, error) {
+	if scheduler.history == nil {
+		return nil, fmt.Errorf("No history is recorded, it has to be enabled with WithHistory")
+	}
+	records, err := scheduler.history.FetchExecutions(context.Background(), string(taskID), filter)
+	if err != nil {
+		return nil, err
+	}
+
+	executions := make([]Execution, 0, len(records))
+	for _, record := range records {
+		execution := Execution{
+			TaskID:      task.ID(record.Hash),
+			Func:        record.Name,
+			ScheduledAt: record.ScheduledAt,
+			StartedAt:   record.StartedAt,
+			FinishedAt:  record.FinishedAt,
+			Attempt:     record.Attempt,
+		}
+		// Params of functions which aren't registered anymore can't be decoded.
+		if function, ok := scheduler.funcManager.Get(record.Name); ok {
+			if funcMeta, err := task.NewFunctionMeta(record.Name, function); err == nil {
+				execution.Params, _ = task.DecodeParams(record.Params, funcMeta.Params())
+			}
+		}
+		if record.Outcome != storage.ExecutionSucceeded {
+			execution.Err = errors.New(record.Error)
+		}
+		executions = append(executions, execution)
+	}
+	return executions, nil
+}
+
+// recordExecution adds the execution to the history, if it's recorded.
+func (scheduler *Scheduler) recordExecution(t *task.Task, execution Execution) {
+	if scheduler.history == nil {
+		return
+	}
+	params, err := t.EncodeParams()
+	if err != nil {
+		log.Printf("Error while recording execution of task %s: %v", execution.TaskID, err)
+		return
+	}
+	record := storage.ExecutionRecord{
+		Hash:        string(execution.TaskID),
+		Name:        execution.Func,
+		Params:      params,
+		ScheduledAt: execution.ScheduledAt,
+		StartedAt:   execution.StartedAt,
+		FinishedAt:  execution.FinishedAt,
+		Attempt:     execution.Attempt,
+		Outcome:     storage.ExecutionSucceeded,
+	}
+	var panicErr *task.PanicError
+	switch {
+	case errors.As(execution.Err, &panicErr):
+		record.Outcome = storage.ExecutionPanicked
+		record.Error = execution.Err.Error()
+	case execution.Err != nil:
+		record.Outcome = storage.ExecutionFailed
+		record.Error = execution.Err.Error()
+	}
+	if err := scheduler.history.AddExecution(context.Background(), record); err != nil {
+		log.Printf("Error while recording execution of task %s: %v", execution.TaskID, err)
+	}
+}
+
+// historyPruneInterval returns how often the history is pruned, zero if it isn't.
+func (scheduler *Scheduler) historyPruneInterval() time.Duration {
+	if scheduler.history == nil || scheduler.historyRetention <= 0 {
+		return 0
+	}
+	if scheduler.historyRetention < maxHistoryPruneInterval {
+		return scheduler.historyRetention
+	}
+	return maxHistoryPruneInterval
+}
+
+// pruneHistory removes the runs which are older than the history's retention.
+func (scheduler *Scheduler) pruneHistory() {
+	before := time.Now().Add(-scheduler.historyRetention)
+	if _, err := scheduler.history.PruneExecutions(context.Background(), before); err != nil {
+		log.Printf("Error while pruning the history: %v", err)
+	}
+}
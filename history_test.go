@@ -0,0 +1,126 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/config"
+	"github.com/ClubNFT/scheduler/storage"
+	"github.com/ClubNFT/scheduler/task"
+)
+
+func TestHistory(t *testing.T) {
+	history := storage.NewMemoryStorage()
+	executions := make(chan Execution, 3)
+	scheduler := New(&lockedStore{t: t}, config.StubMapping{
+		"github.com/ClubNFT/scheduler.computeAnswer": computeAnswer,
+		"github.com/ClubNFT/scheduler.panickingTask": panickingTask,
+	}, WithHistory(history), WithExecutionHook(func(execution Execution) {
+		executions <- execution
+	}))
+	if err := scheduler.Start(); err != nil {
+		t.Fatal("Failed to start scheduler: ", err)
+	}
+	defer scheduler.Stop()
+
+	scheduledAt := time.Now()
+	succeeding, err := scheduler.RunAt(scheduledAt, computeAnswer, "everything")
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	failing, err := scheduler.RunAt(scheduledAt, computeAnswer, "")
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	panicking, err := scheduler.RunAt(scheduledAt, panickingTask)
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-executions:
+		case <-time.After(time.Second):
+			t.Fatal("The tasks should have run")
+		}
+	}
+
+	runs, err := scheduler.History(succeeding, storage.HistoryFilter{})
+	if err != nil {
+		t.Fatal("Querying the history should succeed: ", err)
+	}
+	if len(runs) != 1 {
+		t.Fatalf("The run should be recorded, got %d runs", len(runs))
+	}
+	run := runs[0]
+	if run.TaskID != succeeding || run.Func != "github.com/ClubNFT/scheduler.computeAnswer" ||
+		len(run.Params) != 1 || run.Params[0] != "everything" || run.Attempt != 1 || run.Err != nil {
+		t.Errorf("Unexpected recorded run: %+v", run)
+	}
+	if !run.ScheduledAt.Equal(scheduledAt) || run.StartedAt.Before(scheduledAt) || run.FinishedAt.Before(run.StartedAt) {
+		t.Errorf("Unexpected recorded run times: %+v", run)
+	}
+
+	runs, err = scheduler.History(failing, storage.HistoryFilter{Outcome: storage.ExecutionFailed})
+	if err != nil {
+		t.Fatal("Querying the history should succeed: ", err)
+	}
+	if len(runs) != 1 || runs[0].Err == nil || runs[0].Err.Error() != "no question" {
+		t.Errorf("The failed run should be recorded with its error, got: %+v", runs)
+	}
+
+	records, err := history.FetchExecutions(context.Background(), string(panicking), storage.HistoryFilter{})
+	if err != nil {
+		t.Fatal("Fetching the history should succeed: ", err)
+	}
+	if len(records) != 1 || records[0].Outcome != storage.ExecutionPanicked || records[0].Error == "" {
+		t.Errorf("The panicked run should be recorded as such, got: %+v", records)
+	}
+}
+
+func TestHistoryRequiresHistoryStore(t *testing.T) {
+	scheduler := New(&lockedStore{t: t}, config.StubMapping{})
+	if _, err := scheduler.History(task.ID("hash"), storage.HistoryFilter{}); err == nil {
+		t.Error("Querying the history should fail when it isn't recorded")
+	}
+}
+
+func TestHistoryRetention(t *testing.T) {
+	history := storage.NewMemoryStorage()
+	now := time.Now()
+	for _, finishedAt := range []time.Time{now.Add(-time.Hour), now.Add(time.Hour)} {
+		err := history.AddExecution(context.Background(), storage.ExecutionRecord{
+			Hash:        "hash",
+			ScheduledAt: finishedAt,
+			StartedAt:   finishedAt,
+			FinishedAt:  finishedAt,
+			Attempt:     1,
+			Outcome:     storage.ExecutionSucceeded,
+		})
+		if err != nil {
+			t.Fatal("Recording a run should succeed: ", err)
+		}
+	}
+
+	scheduler := New(&lockedStore{t: t}, config.StubMapping{},
+		WithHistory(history), WithHistoryRetention(20*time.Millisecond))
+	if err := scheduler.Start(); err != nil {
+		t.Fatal("Failed to start scheduler: ", err)
+	}
+	defer scheduler.Stop()
+
+	deadline := time.Now().Add(time.Second)
+	for {
+		runs, err := scheduler.History("hash", storage.HistoryFilter{})
+		if err != nil {
+			t.Fatal("Querying the history should succeed: ", err)
+		}
+		if len(runs) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Runs older than the retention should be pruned, got %d runs", len(runs))
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
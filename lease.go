@@ -0,0 +1,119 @@
+package scheduler
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"time"
+
+	"github.com/ClubNFT/scheduler/storage"
+	"github.com/ClubNFT/scheduler/task"
+)
+
+// defaultLeaseOwner identifies the process, with a random suffix in case several
+// schedulers run within it.
+func defaultLeaseOwner() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		hostname = "unknown"
+	}
+	suffix := make([]byte, 4)
+	_, _ = rand.Read(suffix)
+	return fmt.Sprintf("%s-%d-%s", hostname, os.Getpid(), hex.EncodeToString(suffix))
+}
+
+// leaseDue claims the due tasks for this scheduler if the store can be shared by
+// several schedulers, and reports for each of them whether it may run here. Tasks
+// which can't be leased are run by another scheduler, or were already run by one.
+// The scheduler's lock must be held by the caller. It's released while the tasks are
+// leased, so that scheduling and cancelling tasks doesn't wait for the store.
+func (scheduler *Scheduler) leaseDue(tasks []*task.Task, now time.Time) []bool {
+	leased := make([]bool, len(tasks))
+	store, ok := scheduler.taskStore.leasingStore()
+	if !ok || len(tasks) == 0 {
+		for i := range leased {
+			leased[i] = true
+		}
+		return leased
+	}
+
+	taskIDs := make([]task.ID, len(tasks))
+	for i, t := range tasks {
+		taskIDs[i] = t.Hash()
+	}
+	scheduler.mu.Unlock()
+	for i, taskID := range taskIDs {
+		err := store.Lease(context.Background(), string(taskID), scheduler.leaseOwner, now,
+			now.Add(scheduler.leaseDuration))
+		if err != nil && !errors.Is(err, storage.ErrNotLeased) {
+			log.Printf("Error while leasing task %s: %v", taskID, err)
+		}
+		leased[i] = err == nil
+	}
+	scheduler.mu.Lock()
+
+	for i, taskID := range taskIDs {
+		if leased[i] {
+			scheduler.leased[taskID] = struct{}{}
+		}
+	}
+	return leased
+}
+
+// renewLease renews the lease of the task until ctx is done, and cancels the run if
+// the lease was taken over by another scheduler. The returned function stops
+// renewing and must be called without holding the scheduler's lock.
+func (scheduler *Scheduler) renewLease(taskID task.ID, ctx context.Context, cancel context.CancelFunc) func() {
+	store, ok := scheduler.taskStore.leasingStore()
+	if !ok {
+		return func() {}
+	}
+
+	stop := make(chan struct{})
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		ticker := time.NewTicker(scheduler.leaseDuration / 3)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ctx.Done():
+				return
+			case now := <-ticker.C:
+				err := store.RenewLease(context.Background(), string(taskID), scheduler.leaseOwner,
+					now.Add(scheduler.leaseDuration))
+				if errors.Is(err, storage.ErrNotLeased) {
+					log.Printf("Lost the lease of task %s, cancelling it", taskID)
+					cancel()
+					return
+				}
+				if err != nil {
+					log.Printf("Error while renewing the lease of task %s: %v", taskID, err)
+				}
+			}
+		}
+	}()
+	return func() {
+		close(stop)
+		<-done
+	}
+}
+
+// releaseLease lets other schedulers lease the task once none of its runs are in
+// flight anymore. The scheduler's lock must be held by the caller.
+func (scheduler *Scheduler) releaseLease(taskID task.ID) {
+	store, ok := scheduler.taskStore.leasingStore()
+	if !ok || len(scheduler.running[taskID]) > 0 || scheduler.pool.isWaiting(taskID) {
+		return
+	}
+	if err := store.ReleaseLease(context.Background(), string(taskID), scheduler.leaseOwner); err != nil {
+		log.Printf("Error while releasing the lease of task %s: %v", taskID, err)
+	}
+	delete(scheduler.leased, taskID)
+}
@@ -0,0 +1,226 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/storage"
+)
+
+var leasedRuns = make(chan struct{}, 1)
+
+// runLeased runs long enough for its lease to be renewed a few times.
+func runLeased(ctx context.Context) {
+	leasedRuns <- struct{}{}
+	select {
+	case <-ctx.Done():
+	case <-time.After(200 * time.Millisecond):
+	}
+}
+
+func TestLeasedTaskRunsOnce(t *testing.T) {
+	counter := &callCounter{}
+	store := storage.NewMemoryStorage()
+	first := startScheduler(t, store, mockStubs(counter.count), WithLeaseOwner("first"))
+	second := startScheduler(t, store, mockStubs(counter.count), WithLeaseOwner("second"))
+
+	runAt := time.Now().Add(50 * time.Millisecond)
+	for _, scheduler := range []*Scheduler{first, second} {
+		if _, err := scheduler.RunAt(runAt, counter.count); err != nil {
+			t.Fatal("Creating a task should succeed: ", err)
+		}
+	}
+
+	time.Sleep(200 * time.Millisecond)
+	if calls := counter.Calls(); calls != 1 {
+		t.Errorf("A task shared by two schedulers should run once, ran %d times", calls)
+	}
+	if store.Len() != 0 {
+		t.Error("The task should be removed once it ran")
+	}
+}
+
+func TestLeaseIsRenewedWhileRunning(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	scheduler := startScheduler(t, store, mockStubs(runLeased),
+		WithLeaseOwner("first"), WithLeaseDuration(30*time.Millisecond))
+	taskID, err := scheduler.RunAt(time.Now(), runLeased)
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+
+	select {
+	case <-leasedRuns:
+	case <-time.After(time.Second):
+		t.Fatal("The task should have run")
+	}
+	time.Sleep(100 * time.Millisecond)
+	now := time.Now()
+	err = store.Lease(context.Background(), string(taskID), "second", now, now.Add(time.Minute))
+	if !errors.Is(err, storage.ErrNotLeased) {
+		t.Error("The lease of a running task should be renewed, got: ", err)
+	}
+}
+
+func TestExpiredLeaseIsTakenOver(t *testing.T) {
+	counter := &callCounter{}
+	store := storage.NewMemoryStorage()
+	scheduler := New(store, mockStubs(counter.count), WithLeaseOwner("second"))
+	taskID, err := scheduler.RunEvery(time.Hour, counter.count)
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+
+	// The task was leased by a scheduler which stopped before running it.
+	past := time.Now().Add(-time.Minute)
+	_ = store.Update(context.Background(), storage.TaskAttributes{
+		Hash:    string(taskID),
+		NextRun: past.Format(time.RFC3339),
+		LastRun: past.Format(time.RFC3339),
+	})
+	if err := store.Lease(context.Background(), string(taskID), "first", past, past.Add(time.Second)); err != nil {
+		t.Fatal("Leasing the task should succeed: ", err)
+	}
+
+	scheduler.mu.Lock()
+	scheduler.tasks[taskID].NextRun = past
+	scheduler.queue.schedule(scheduler.tasks[taskID])
+	scheduler.runPending()
+	scheduler.mu.Unlock()
+
+	deadline := time.Now().Add(time.Second)
+	for counter.Calls() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if counter.Calls() != 1 {
+		t.Error("A task whose lease expired should be taken over")
+	}
+}
+
+// blockingLeaseStore blocks leasing and renewing leases while it's blocked.
+type blockingLeaseStore struct {
+	*storage.MemoryStorage
+	leasing chan struct{}
+
+	mu      sync.Mutex
+	release chan struct{}
+}
+
+func newBlockingLeaseStore() *blockingLeaseStore {
+	return &blockingLeaseStore{
+		MemoryStorage: storage.NewMemoryStorage(),
+		leasing:       make(chan struct{}, 1),
+		release:       make(chan struct{}),
+	}
+}
+
+func (store *blockingLeaseStore) block() {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	store.release = make(chan struct{})
+}
+
+func (store *blockingLeaseStore) unblock() {
+	store.mu.Lock()
+	defer store.mu.Unlock()
+	close(store.release)
+}
+
+func (store *blockingLeaseStore) wait() {
+	select {
+	case store.leasing <- struct{}{}:
+	default:
+	}
+	store.mu.Lock()
+	release := store.release
+	store.mu.Unlock()
+	<-release
+}
+
+func (store *blockingLeaseStore) Lease(ctx context.Context, hash, owner string, now, until time.Time) error {
+	store.wait()
+	return store.MemoryStorage.Lease(ctx, hash, owner, now, until)
+}
+
+func (store *blockingLeaseStore) RenewLease(ctx context.Context, hash, owner string, until time.Time) error {
+	store.wait()
+	return store.MemoryStorage.RenewLease(ctx, hash, owner, until)
+}
+
+func TestLeasingDoesNotBlockScheduling(t *testing.T) {
+	counter := &callCounter{}
+	store := newBlockingLeaseStore()
+	scheduler := startScheduler(t, store, mockStubs(counter.count))
+	taskID, err := scheduler.RunAt(time.Now(), counter.count)
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	select {
+	case <-store.leasing:
+	case <-time.After(time.Second):
+		t.Fatal("The due task should be leased")
+	}
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if _, err := scheduler.RunEvery(time.Hour, counter.count); err != nil {
+			t.Error("Creating a task should succeed: ", err)
+		}
+		_ = scheduler.IsRunning(taskID)
+		if err := scheduler.Cancel(taskID); err != nil {
+			t.Error("Cancelling a task which is being leased should succeed: ", err)
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Scheduling and cancelling tasks should not wait for the store to lease tasks")
+	}
+
+	store.unblock()
+	time.Sleep(50 * time.Millisecond)
+	if calls := counter.Calls(); calls != 0 {
+		t.Errorf("A task which was cancelled while it was leased should not run, ran %d times", calls)
+	}
+}
+
+func TestRenewingLeasesDoesNotBlockScheduling(t *testing.T) {
+	store := newBlockingLeaseStore()
+	store.unblock()
+	scheduler := startScheduler(t, store, mockStubs(runLeased), WithLeaseDuration(30*time.Millisecond))
+	taskID, err := scheduler.RunAt(time.Now(), runLeased)
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	select {
+	case <-leasedRuns:
+	case <-time.After(time.Second):
+		t.Fatal("The task should have run")
+	}
+
+	store.block()
+	defer store.unblock()
+	select {
+	case <-store.leasing:
+	default:
+	}
+	select {
+	case <-store.leasing:
+	case <-time.After(time.Second):
+		t.Fatal("The lease of the running task should be renewed")
+	}
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		_ = scheduler.IsRunning(taskID)
+	}()
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Error("Querying the scheduler should not wait for the store to renew a lease")
+	}
+}
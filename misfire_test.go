@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/storage"
+	"github.com/ClubNFT/scheduler/task"
+)
+
+// runMissed runs the task as if the scheduler was down since missedSince, when its
+// next run was due.
+func runMissed(scheduler *Scheduler, taskID task.ID, missedSince time.Time) {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	t := scheduler.tasks[taskID]
+	t.NextRun = missedSince
+	_ = scheduler.taskStore.Update(context.Background(), t)
+	scheduler.queue.schedule(t)
+	scheduler.runPending()
+}
+
+func TestMisfiredRunsFireOnce(t *testing.T) {
+	counter := &callCounter{}
+	store := storage.NewMemoryStorage()
+	scheduler := New(store, mockStubs(counter.count))
+	taskID, err := scheduler.RunEvery(time.Minute, counter.count)
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+
+	now := time.Now()
+	runMissed(scheduler, taskID, now.Add(-24*time.Hour))
+	deadline := time.Now().Add(time.Second)
+	for counter.Calls() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	scheduler.runPending()
+	if calls := counter.Calls(); calls != 1 {
+		t.Errorf("A task which missed its runs should run once, ran %d times", calls)
+	}
+	if nextRun := scheduler.tasks[taskID].NextRun; !nextRun.After(now) {
+		t.Errorf("The task should continue with its next run after now, got %s", nextRun)
+	}
+}
+
+func TestMisfiredRunsAreSkipped(t *testing.T) {
+	counter := &callCounter{}
+	store := storage.NewMemoryStorage()
+	scheduler := New(store, mockStubs(counter.count))
+	runner := scheduler.With(WithMisfirePolicy(task.MisfirePolicy{Mode: task.MisfireSkip}))
+	recurring, err := runner.RunEvery(time.Minute, counter.count)
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	oneOff, err := runner.RunAt(time.Now().Add(time.Hour), counter.count)
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+
+	now := time.Now()
+	runMissed(scheduler, recurring, now.Add(-24*time.Hour-30*time.Second))
+	runMissed(scheduler, oneOff, now.Add(-time.Hour))
+	time.Sleep(50 * time.Millisecond)
+
+	if calls := counter.Calls(); calls != 0 {
+		t.Errorf("Missed runs should be skipped, ran %d times", calls)
+	}
+	tasks, err := store.Fetch(context.Background())
+	if err != nil || len(tasks) != 1 {
+		t.Fatal("The one-off task should be removed once its run was skipped")
+	}
+	if tasks[0].Hash != string(recurring) || tasks[0].MisfirePolicy == "" {
+		t.Errorf("The misfire policy should be stored, found %+v", tasks[0])
+	}
+	if nextRun, _ := time.Parse(time.RFC3339, tasks[0].NextRun); !nextRun.After(now) {
+		t.Errorf("The stored next run should be after now, got %s", tasks[0].NextRun)
+	}
+}
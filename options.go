@@ -0,0 +1,240 @@
+package scheduler
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/ClubNFT/scheduler/task"
+)
+
+// Option configures optional settings of a Scheduler.
+type Option func(*Scheduler)
+
+// WithExecutionHook registers hook to be called after every execution of a task,
+// including the value returned by the function and the error it failed with.
+// Hooks are called sequentially from the goroutine which ran the task.
+func WithExecutionHook(hook func(Execution)) Option {
+	return func(scheduler *Scheduler) {
+		scheduler.executionHooks = append(scheduler.executionHooks, hook)
+	}
+}
+
+// WithLookahead sets how far ahead tasks are loaded from stores which implement
+// storage.DueTaskStore, the default is one minute. Tasks due later are only kept in
+// the store until they're due soon.
+func WithLookahead(lookahead time.Duration) Option {
+	return func(scheduler *Scheduler) {
+		scheduler.lookahead = lookahead
+	}
+}
+
+// WithLeaseOwner sets the name under which tasks are leased from stores which
+// implement storage.LeasingTaskStore. It has to be unique among the schedulers
+// sharing a store, the default combines the host name, process ID and a random suffix.
+func WithLeaseOwner(owner string) Option {
+	return func(scheduler *Scheduler) {
+		scheduler.leaseOwner = owner
+	}
+}
+
+// WithLeaseDuration sets how long tasks are leased from stores which implement
+// storage.LeasingTaskStore, the default is 30 seconds. Leases are renewed while
+// tasks run, a scheduler which stopped renewing them has its tasks taken over by
+// the others once its leases expired.
+func WithLeaseDuration(duration time.Duration) Option {
+	return func(scheduler *Scheduler) {
+		scheduler.leaseDuration = duration
+	}
+}
+
+// WithLeaderElection makes only one of the schedulers sharing a store run tasks, the
+// store has to implement storage.LeaderElector. Every scheduler polls the store each
+// interval to find out whether it leads. Standbys still schedule tasks, which are
+// stored and loaded by the leader on its next poll.
+func WithLeaderElection(interval time.Duration) Option {
+	return func(scheduler *Scheduler) {
+		scheduler.electionInterval = interval
+	}
+}
+
+// WithLeadershipHook registers hook to be called whenever the scheduler becomes the
+// leader or stops leading, see WithLeaderElection.
+func WithLeadershipHook(hook func(leading bool)) Option {
+	return func(scheduler *Scheduler) {
+		scheduler.leadershipHooks = append(scheduler.leadershipHooks, hook)
+	}
+}
+
+// TaskOption configures optional settings of a single task.
+type TaskOption func(*task.Task)
+
+// InLocation makes the recurrences of a task follow the wall clock of loc, so that
+// e.g. a daily 09:00 task keeps running at 09:00 local time across DST changes.
+//
+// Cron expressions are matched against the wall clock in loc. Intervals of 24 hours
+// or more advance the calendar date by whole days and keep the wall-clock time of
+// the first run. A wall-clock time skipped when clocks spring forward runs the same
+// distance after the transition (02:30 runs at 03:30), and a wall-clock time
+// repeated when clocks fall back runs only once, at its first occurrence.
+func InLocation(loc *time.Location) TaskOption {
+	return func(t *task.Task) {
+		t.Location = loc
+	}
+}
+
+// WithTimeout limits every execution of a task to timeout. Functions whose first
+// parameter is a context.Context see it cancelled once the timeout expires.
+func WithTimeout(timeout time.Duration) TaskOption {
+	return func(t *task.Task) {
+		t.Timeout = timeout
+	}
+}
+
+// WithRetry retries failed executions of a task according to policy. An execution
+// fails when the function returns a non-nil error as its last result or panics.
+func WithRetry(policy task.RetryPolicy) TaskOption {
+	return func(t *task.Task) {
+		t.Retry = policy
+	}
+}
+
+// WithMisfirePolicy sets how runs of a task are handled which were missed, e.g.
+// because no scheduler was running at the time. By default a task which missed
+// several runs runs once and continues with its next run after now, see
+// task.MisfirePolicy.
+func WithMisfirePolicy(policy task.MisfirePolicy) TaskOption {
+	return func(t *task.Task) {
+		t.Misfire = policy
+	}
+}
+
+// WithOverlapPolicy sets what happens to runs of a task which are due while its
+// previous run is still in progress. By default they run alongside it.
+func WithOverlapPolicy(policy task.OverlapPolicy) TaskOption {
+	return func(t *task.Task) {
+		t.Overlap = policy
+	}
+}
+
+// Runner schedules tasks on a Scheduler with a set of TaskOptions applied.
+type Runner struct {
+	scheduler *Scheduler
+	options   []TaskOption
+}
+
+// With returns a Runner which applies options to every task it schedules.
+func (scheduler *Scheduler) With(options ...TaskOption) Runner {
+	return Runner{scheduler: scheduler, options: options}
+}
+
+// RunAt will schedule function to be executed once at the given time.
+func (runner Runner) RunAt(time time.Time, function task.Function, params ...task.Param) (task.ID, error) {
+	task, err := runner.newTask(function, params)
+	if err != nil {
+		return "", err
+	}
+
+	task.NextRun = time
+
+	return runner.schedule(task)
+}
+
+// RunAfter executes function once after a specific duration has elapsed.
+func (runner Runner) RunAfter(duration time.Duration, function task.Function, params ...task.Param) (task.ID, error) {
+	return runner.RunAt(time.Now().Add(duration), function, params...)
+}
+
+// RunEvery will schedule function to be executed every time the duration has elapsed.
+func (runner Runner) RunEvery(duration time.Duration, function task.Function, params ...task.Param) (task.ID, error) {
+	task, err := runner.newTask(function, params)
+	if err != nil {
+		return "", err
+	}
+
+	task.IsRecurring = true
+	task.Duration = duration
+	task.NextRun = time.Now().Add(duration)
+	task.FirstRun = task.NextRun
+
+	return runner.schedule(task)
+}
+
+// RunCron will schedule function to be executed whenever the cron expression matches.
+func (runner Runner) RunCron(expr string, function task.Function, params ...task.Param) (task.ID, error) {
+	cron, err := task.ParseCron(expr)
+	if err != nil {
+		return "", err
+	}
+	task, err := runner.newTask(function, params)
+	if err != nil {
+		return "", err
+	}
+
+	task.IsRecurring = true
+	task.CronExpr = expr
+	now := time.Now()
+	if task.Location != nil {
+		now = now.In(task.Location)
+	}
+	task.NextRun = cron.Next(now)
+	if task.NextRun.IsZero() {
+		return "", fmt.Errorf("Cron expression %q never matches", expr)
+	}
+
+	return runner.schedule(task)
+}
+
+func (runner Runner) newTask(function task.Function, params []task.Param) (*task.Task, error) {
+	meta, err := task.Translate(function)
+	if err != nil {
+		return nil, err
+	}
+
+	// The task will call the function registered in the stub mapping, so
+	// that's the one params have to match.
+	registered, ok := runner.scheduler.funcManager.Get(meta.Name)
+	if !ok {
+		return nil, fmt.Errorf("Function %s is not registered in the stub mapping, add it with the key %q",
+			meta.Name, meta.Name)
+	}
+	if meta, err = task.NewFunctionMeta(meta.Name, registered); err != nil {
+		return nil, err
+	}
+	if err := task.ValidateParams(params, meta.Params()); err != nil {
+		return nil, fmt.Errorf("Invalid params for function %s: %s", meta.Name, err)
+	}
+
+	t := task.New(meta, params, runner.scheduler.funcManager)
+	// Params go through the same JSON round trip as when they're loaded from
+	// the store, so that tasks behave the same before and after a restart.
+	encoded, err := t.EncodeParams()
+	if err != nil {
+		return nil, err
+	}
+	if t.Params, err = task.DecodeParams(encoded, meta.Params()); err != nil {
+		return nil, err
+	}
+	for _, option := range runner.options {
+		option(t)
+	}
+	return t, nil
+}
+
+func (runner Runner) schedule(task *task.Task) (task.ID, error) {
+	runner.scheduler.mu.Lock()
+	defer runner.scheduler.mu.Unlock()
+
+	if _, ok := runner.scheduler.taskStore.dueStore(); ok {
+		// Only the new task is stored instead of refreshing all of them.
+		if err := runner.scheduler.addDueTask(task); err != nil {
+			return "", err
+		}
+		return task.Hash(), nil
+	}
+
+	runner.scheduler.registerTask(task)
+	if err := runner.scheduler.refresh(); err != nil {
+		return "", err
+	}
+	return task.Hash(), nil
+}
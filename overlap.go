@@ -0,0 +1,70 @@
+package scheduler
+
+import (
+	"log"
+	"sort"
+	"time"
+
+	"github.com/ClubNFT/scheduler/task"
+)
+
+// holdOverlappingRun reports whether the due run of the task must not start because
+// a previous run is still in progress, and queues it if the task's overlap policy
+// says so. The scheduler's lock must be held by the caller.
+func (scheduler *Scheduler) holdOverlappingRun(t *task.Task, scheduledAt time.Time) bool {
+	taskID := t.Hash()
+	if _, running := scheduler.running[taskID]; !running && !scheduler.pool.isWaiting(taskID) ||
+		t.Overlap == task.OverlapAllow {
+		return false
+	}
+
+	if _, queued := scheduler.queuedRuns[taskID]; t.Overlap == task.OverlapQueue && !queued {
+		scheduler.queuedRuns[taskID] = scheduledAt
+		return true
+	}
+	log.Printf("Skipping run of function %s due at %s, the previous run is still in progress",
+		t.Func.Name, scheduledAt.Format(time.RFC3339))
+	return true
+}
+
+// runQueued starts the run of the task which was queued while its previous run was
+// in progress, once that run finished. The scheduler's lock must be held by the caller.
+func (scheduler *Scheduler) runQueued(taskID task.ID) {
+	scheduledAt, queued := scheduler.queuedRuns[taskID]
+	if _, running := scheduler.running[taskID]; !queued || running {
+		return
+	}
+	delete(scheduler.queuedRuns, taskID)
+
+	// The task may have been cancelled or the scheduler stopped meanwhile.
+	if t, ok := scheduler.tasks[taskID]; ok && scheduler.leads() && scheduler.dispatchCtx.Err() == nil {
+		scheduler.execute(t, scheduledAt)
+	}
+}
+
+// IsRunning reports whether a run of the task is in progress.
+func (scheduler *Scheduler) IsRunning(taskID task.ID) bool {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	_, running := scheduler.running[taskID]
+	return running
+}
+
+// Running returns the runs of tasks which are in progress. Their FinishedAt, Result
+// and Err aren't set yet.
+func (scheduler *Scheduler) Running() []Execution {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	var executions []Execution
+	for _, runs := range scheduler.running {
+		for run := range runs {
+			executions = append(executions, run.execution)
+		}
+	}
+	sort.Slice(executions, func(i, j int) bool {
+		return executions[i].StartedAt.Before(executions[j].StartedAt)
+	})
+	return executions
+}
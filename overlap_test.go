@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/task"
+)
+
+func newOverlapScheduler(t *testing.T, tracker *runTracker, policy task.OverlapPolicy) (*Scheduler, task.ID) {
+	scheduler := startScheduler(t, &lockedStore{t: t}, mockStubs(tracker.run))
+	taskID, err := scheduler.With(WithOverlapPolicy(policy)).RunEvery(10*time.Millisecond, tracker.run, "overlapping")
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	return scheduler, taskID
+}
+
+func TestOverlappingRunsAreSkipped(t *testing.T) {
+	tracker := newRunTracker()
+	scheduler, taskID := newOverlapScheduler(t, tracker, task.OverlapSkip)
+
+	time.Sleep(100 * time.Millisecond)
+	if calls, _ := tracker.counts(); calls != 1 {
+		t.Errorf("Runs due while the previous run is in progress should be skipped, ran %d times", calls)
+	}
+	if !scheduler.IsRunning(taskID) {
+		t.Error("The task should be reported as running")
+	}
+	running := scheduler.Running()
+	if len(running) != 1 || running[0].TaskID != taskID || running[0].StartedAt.IsZero() {
+		t.Errorf("The run in progress should be reported, got %+v", running)
+	}
+
+	close(tracker.release)
+	time.Sleep(50 * time.Millisecond)
+	if calls, maxActive := tracker.counts(); calls < 2 || maxActive != 1 {
+		t.Errorf("The task should run again once the previous run finished, without overlapping, "+
+			"ran %d times with %d at once", calls, maxActive)
+	}
+}
+
+func TestOverlappingRunIsQueued(t *testing.T) {
+	tracker := newRunTracker()
+	scheduler, taskID := newOverlapScheduler(t, tracker, task.OverlapQueue)
+
+	time.Sleep(100 * time.Millisecond)
+	if calls, _ := tracker.counts(); calls != 1 {
+		t.Errorf("Runs due while the previous run is in progress should wait for it, ran %d times", calls)
+	}
+
+	// The queued run starts right away, it's blocked as well.
+	tracker.release <- struct{}{}
+	tracker.waitForCalls(2)
+	if calls, maxActive := tracker.counts(); calls != 2 || maxActive != 1 {
+		t.Errorf("The queued run should start once the previous run finished, ran %d times with %d at once",
+			calls, maxActive)
+	}
+	if !scheduler.IsRunning(taskID) {
+		t.Error("The queued run should be reported as running")
+	}
+	close(tracker.release)
+}
+
+func TestOverlappingRunsAreAllowed(t *testing.T) {
+	tracker := newRunTracker()
+	defer close(tracker.release)
+	newOverlapScheduler(t, tracker, task.OverlapAllow)
+
+	time.Sleep(100 * time.Millisecond)
+	if _, maxActive := tracker.counts(); maxActive < 2 {
+		t.Error("Runs should overlap by default")
+	}
+}
@@ -0,0 +1,144 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/config"
+	"github.com/ClubNFT/scheduler/storage"
+	"github.com/ClubNFT/scheduler/task"
+)
+
+type greeting struct {
+	Name  string
+	Times int
+}
+
+var greetings = make(chan greeting, 1)
+
+func greet(g greeting, loud bool) {
+	greetings <- g
+}
+
+func TestTypedParams(t *testing.T) {
+	scheduler := New(&lockedStore{t: t}, config.StubMapping{
+		"github.com/ClubNFT/scheduler.greet": greet,
+	})
+
+	if _, err := scheduler.RunAt(time.Now(), greet, greeting{Name: "World"}); err == nil {
+		t.Error("Scheduling with a missing param should fail")
+	}
+	if _, err := scheduler.RunAt(time.Now(), greet, "World", true); err == nil {
+		t.Error("Scheduling with a param of the wrong type should fail")
+	}
+
+	if err := scheduler.Start(); err != nil {
+		t.Fatal("Failed to start scheduler: ", err)
+	}
+	defer scheduler.Stop()
+	if _, err := scheduler.RunAt(time.Now(), greet, greeting{Name: "World", Times: 2}, true); err != nil {
+		t.Fatal("Scheduling with typed params should succeed: ", err)
+	}
+	select {
+	case g := <-greetings:
+		if g.Name != "World" || g.Times != 2 {
+			t.Errorf("Unexpected params: %+v", g)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The task should have been executed")
+	}
+}
+
+func unregistered() {}
+
+func registeredAsNil() {}
+
+func TestScheduleValidatesRegistration(t *testing.T) {
+	scheduler := New(&lockedStore{t: t}, config.StubMapping{
+		"github.com/ClubNFT/scheduler.greet": greet,
+		// A stub registered under the name of a different function is what
+		// gets called, so params have to match its signature.
+		"github.com/ClubNFT/scheduler.countCall":       greet,
+		"github.com/ClubNFT/scheduler.registeredAsNil": nil,
+	})
+
+	cases := []struct {
+		name     string
+		schedule func() error
+	}{
+		{"unregistered function", func() error {
+			_, err := scheduler.RunAt(time.Now(), unregistered)
+			return err
+		}},
+		{"nil stub", func() error {
+			_, err := scheduler.RunAfter(time.Second, registeredAsNil)
+			return err
+		}},
+		{"wrong arity", func() error {
+			_, err := scheduler.RunEvery(time.Second, greet, greeting{})
+			return err
+		}},
+		{"wrong param type", func() error {
+			_, err := scheduler.RunCron("@daily", greet, greeting{}, "loud")
+			return err
+		}},
+		{"params of the registered stub", func() error {
+			_, err := scheduler.RunAt(time.Now(), countCall, "id")
+			return err
+		}},
+	}
+	for _, c := range cases {
+		if err := c.schedule(); err == nil {
+			t.Errorf("Scheduling with %s should fail", c.name)
+		}
+	}
+
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	if len(scheduler.tasks) != 0 {
+		t.Error("Invalid tasks should not be registered")
+	}
+}
+
+func greetPointer(g *greeting) {}
+
+func sum(values []int) {}
+
+func TestParamsKeepTheirHashThroughTheStore(t *testing.T) {
+	store := storage.NewMemoryStorage()
+	scheduler := New(store, config.StubMapping{
+		"github.com/ClubNFT/scheduler.greetPointer": greetPointer,
+		"github.com/ClubNFT/scheduler.greet":        greet,
+		"github.com/ClubNFT/scheduler.sum":          sum,
+	})
+
+	var taskIDs []task.ID
+	for _, schedule := range []func() (task.ID, error){
+		func() (task.ID, error) { return scheduler.RunEvery(time.Hour, greetPointer, &greeting{Name: "World"}) },
+		func() (task.ID, error) { return scheduler.RunEvery(time.Hour, greet, greeting{Name: "World"}, true) },
+		func() (task.ID, error) { return scheduler.RunEvery(time.Hour, sum, []int{1}) },
+	} {
+		taskID, err := schedule()
+		if err != nil {
+			t.Fatal("Creating a task should succeed: ", err)
+		}
+		taskIDs = append(taskIDs, taskID)
+	}
+	for i := 0; i < 3; i++ {
+		if err := scheduler.Refresh(); err != nil {
+			t.Fatal("Refreshing tasks should not fail: ", err)
+		}
+	}
+
+	if store.Len() != len(taskIDs) {
+		t.Errorf("Every task should be stored once, found %d rows", store.Len())
+	}
+	for _, taskID := range taskIDs {
+		if _, found := store.Get(string(taskID)); !found {
+			t.Errorf("Task %s should be stored under its ID", taskID)
+		}
+	}
+	if taskCount(scheduler) != len(taskIDs) {
+		t.Errorf("Every task should be registered once, found %d", taskCount(scheduler))
+	}
+}
@@ -0,0 +1,185 @@
+package scheduler
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/ClubNFT/scheduler/task"
+)
+
+// workerPool limits the number of concurrent runs. Due runs which can't start yet
+// wait in a bounded queue, the tasks due after the queue filled up stay scheduled
+// until there's room again. The zero value doesn't limit runs.
+type workerPool struct {
+	// maxWorkers is the maximum number of concurrent runs, zero if unlimited.
+	maxWorkers int
+	// maxQueued is the maximum number of runs waiting for a worker.
+	maxQueued int
+	// funcLimits holds the maximum number of concurrent runs per function name.
+	funcLimits map[string]int
+
+	busy      int
+	busyFuncs map[string]int
+	waiting   []*pendingRun
+	// saturated is set when due tasks were left scheduled because the queue was
+	// full, they're reconsidered once a run finished.
+	saturated bool
+}
+
+// pendingRun is a due run of a task which is started, or waits for a worker until
+// then. Its context is cancelled if the task is cancelled or loses its lease.
+type pendingRun struct {
+	task         *task.Task
+	scheduledAt  time.Time
+	ctx          context.Context
+	cancel       context.CancelFunc
+	stopRenewing func()
+}
+
+// PoolStats describes the load of the scheduler's worker pool, see WithMaxConcurrency.
+type PoolStats struct {
+	// MaxWorkers is the maximum number of concurrent runs, zero if unlimited.
+	MaxWorkers int
+	// Busy is the number of runs in progress.
+	Busy int
+	// Queued is the number of due runs waiting for a worker and QueueCapacity
+	// the maximum number of them.
+	Queued        int
+	QueueCapacity int
+	// Saturated is set while due tasks are held back because the queue is full.
+	Saturated bool
+}
+
+// WithMaxConcurrency limits the number of tasks running at once to workers. Due runs
+// which can't start wait in a queue of up to queued runs, see WithFunctionConcurrency.
+// Tasks due while the queue is full stay scheduled until a run finished.
+func WithMaxConcurrency(workers, queued int) Option {
+	return func(scheduler *Scheduler) {
+		scheduler.pool.maxWorkers = workers
+		scheduler.pool.maxQueued = queued
+	}
+}
+
+// WithFunctionConcurrency limits the number of runs of function at once to limit, in
+// addition to WithMaxConcurrency. Runs which can't start wait in the queue set by
+// WithMaxConcurrency, which has to have room for them.
+func WithFunctionConcurrency(function task.Function, limit int) Option {
+	return func(scheduler *Scheduler) {
+		meta, err := task.Translate(function)
+		if err != nil {
+			log.Printf("Error while limiting the concurrency of function %v: %v", function, err)
+			return
+		}
+		if scheduler.pool.funcLimits == nil {
+			scheduler.pool.funcLimits = make(map[string]int)
+		}
+		scheduler.pool.funcLimits[meta.Name] = limit
+	}
+}
+
+// PoolStats returns the current load of the worker pool.
+func (scheduler *Scheduler) PoolStats() PoolStats {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	return PoolStats{
+		MaxWorkers:    scheduler.pool.maxWorkers,
+		Busy:          scheduler.pool.busy,
+		Queued:        len(scheduler.pool.waiting),
+		QueueCapacity: scheduler.pool.maxQueued,
+		Saturated:     scheduler.pool.saturated,
+	}
+}
+
+// canStart reports whether a run of the function can start right away.
+func (pool *workerPool) canStart(funcName string) bool {
+	if pool.maxWorkers > 0 && pool.busy >= pool.maxWorkers {
+		return false
+	}
+	limit, limited := pool.funcLimits[funcName]
+	return !limited || pool.busyFuncs[funcName] < limit
+}
+
+// room returns the number of due runs which may be dispatched, counting the free
+// workers and the room in the queue. It's negative if runs aren't limited.
+func (pool *workerPool) room() int {
+	if pool.maxWorkers == 0 {
+		return -1
+	}
+	room := pool.maxWorkers - pool.busy + pool.maxQueued - len(pool.waiting)
+	if room < 0 {
+		return 0
+	}
+	return room
+}
+
+// admits reports whether a run of the function may be dispatched.
+func (pool *workerPool) admits(funcName string) bool {
+	return pool.canStart(funcName) || len(pool.waiting) < pool.maxQueued
+}
+
+// isWaiting reports whether a run of the task waits for a worker.
+func (pool *workerPool) isWaiting(taskID task.ID) bool {
+	for _, run := range pool.waiting {
+		if run.task.Hash() == taskID {
+			return true
+		}
+	}
+	return false
+}
+
+// acquire reserves a worker for a run of the function.
+func (pool *workerPool) acquire(funcName string) {
+	pool.busy++
+	if pool.busyFuncs == nil {
+		pool.busyFuncs = make(map[string]int)
+	}
+	pool.busyFuncs[funcName]++
+}
+
+// release frees the worker of a finished run of the function.
+func (pool *workerPool) release(funcName string) {
+	pool.busy--
+	if pool.busyFuncs[funcName]--; pool.busyFuncs[funcName] == 0 {
+		delete(pool.busyFuncs, funcName)
+	}
+	pool.saturated = false
+}
+
+// cancelWaiting drops the waiting runs of the task, and reports whether there were any.
+// The scheduler's lock must be held by the caller.
+func (scheduler *Scheduler) cancelWaiting(taskID task.ID) bool {
+	found := false
+	waiting := scheduler.pool.waiting[:0]
+	for _, run := range scheduler.pool.waiting {
+		if run.task.Hash() == taskID {
+			run.cancel()
+			found = true
+			continue
+		}
+		waiting = append(waiting, run)
+	}
+	scheduler.pool.waiting = waiting
+	return found
+}
+
+// startWaiting starts the waiting runs for which workers are free, in the order they
+// were queued. The scheduler's lock must be held by the caller.
+func (scheduler *Scheduler) startWaiting() {
+	if scheduler.dispatchCtx.Err() != nil {
+		return
+	}
+	waiting := scheduler.pool.waiting[:0]
+	for _, run := range scheduler.pool.waiting {
+		switch {
+		case run.ctx.Err() != nil:
+			// The scheduler stopped or the task lost its lease meanwhile.
+		case scheduler.pool.canStart(run.task.Func.Name):
+			scheduler.start(run)
+		default:
+			waiting = append(waiting, run)
+		}
+	}
+	scheduler.pool.waiting = waiting
+}
@@ -0,0 +1,95 @@
+package scheduler
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMaxConcurrency(t *testing.T) {
+	tracker := newRunTracker()
+	scheduler := startScheduler(t, &lockedStore{t: t}, mockStubs(tracker.run), WithMaxConcurrency(2, 1))
+
+	now := time.Now()
+	for i := 0; i < 5; i++ {
+		if _, err := scheduler.RunAt(now, tracker.run, fmt.Sprint(i)); err != nil {
+			t.Fatal("Creating a task should succeed: ", err)
+		}
+	}
+	tracker.waitForCalls(2)
+	time.Sleep(50 * time.Millisecond)
+
+	stats := scheduler.PoolStats()
+	if stats.MaxWorkers != 2 || stats.Busy != 2 || stats.Queued != 1 || stats.QueueCapacity != 1 || !stats.Saturated {
+		t.Errorf("Unexpected pool stats: %+v", stats)
+	}
+	if calls, _ := tracker.counts(); calls != 2 {
+		t.Errorf("Only as many tasks as there are workers should run, ran %d", calls)
+	}
+
+	close(tracker.release)
+	tracker.waitForCalls(5)
+	if calls, maxActive := tracker.counts(); calls != 5 || maxActive != 2 {
+		t.Errorf("All tasks should run once workers are free, ran %d with %d at once", calls, maxActive)
+	}
+}
+
+func TestFunctionConcurrency(t *testing.T) {
+	tracker := newRunTracker()
+	counter := &callCounter{}
+	scheduler := startScheduler(t, &lockedStore{t: t}, mockStubs(tracker.run, counter.count),
+		WithFunctionConcurrency(tracker.run, 1))
+
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		if _, err := scheduler.RunAt(now, tracker.run, fmt.Sprint(i)); err != nil {
+			t.Fatal("Creating a task should succeed: ", err)
+		}
+	}
+	if _, err := scheduler.RunAt(now, counter.count); err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	tracker.waitForCalls(1)
+	time.Sleep(50 * time.Millisecond)
+
+	if calls, _ := tracker.counts(); calls != 1 {
+		t.Errorf("The function should run once at a time, ran %d", calls)
+	}
+	if counter.Calls() != 1 {
+		t.Error("Other functions should not be limited")
+	}
+
+	close(tracker.release)
+	tracker.waitForCalls(3)
+	if calls, maxActive := tracker.counts(); calls != 3 || maxActive != 1 {
+		t.Errorf("All runs of the function should run one after the other, ran %d with %d at once", calls, maxActive)
+	}
+}
+
+func TestCancelWaitingRun(t *testing.T) {
+	tracker := newRunTracker()
+	scheduler := startScheduler(t, &lockedStore{t: t}, mockStubs(tracker.run), WithMaxConcurrency(1, 1))
+
+	now := time.Now()
+	if _, err := scheduler.RunAt(now, tracker.run, "running"); err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	waiting, err := scheduler.RunAt(now, tracker.run, "waiting")
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	tracker.waitForCalls(1)
+	time.Sleep(20 * time.Millisecond)
+
+	if err := scheduler.Cancel(waiting); err != nil {
+		t.Fatal("Cancelling a waiting task should succeed: ", err)
+	}
+	if stats := scheduler.PoolStats(); stats.Queued != 0 {
+		t.Errorf("The cancelled run should leave the queue, got %+v", stats)
+	}
+	close(tracker.release)
+	time.Sleep(50 * time.Millisecond)
+	if calls, _ := tracker.counts(); calls != 1 {
+		t.Errorf("The cancelled run should not start, ran %d tasks", calls)
+	}
+}
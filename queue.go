@@ -0,0 +1,94 @@
+package scheduler
+
+import (
+	"container/heap"
+	"time"
+
+	"github.com/ClubNFT/scheduler/task"
+)
+
+// taskQueue is a priority queue of tasks ordered by the time they are due. The
+// position of every task is tracked so that it can be updated or removed
+// without scanning the queue.
+type taskQueue struct {
+	items []queueItem
+	index map[task.ID]int
+}
+
+// queueItem keeps the ID next to the task so that the queue doesn't need to
+// recompute hashes while reordering.
+type queueItem struct {
+	id   task.ID
+	task *task.Task
+}
+
+func newTaskQueue() *taskQueue {
+	return &taskQueue{index: make(map[task.ID]int)}
+}
+
+// Len, Less, Swap, Push and Pop implement heap.Interface and should only be
+// called through the container/heap package.
+func (queue *taskQueue) Len() int {
+	return len(queue.items)
+}
+
+func (queue *taskQueue) Less(i, j int) bool {
+	return queue.items[i].task.DueAt().Before(queue.items[j].task.DueAt())
+}
+
+func (queue *taskQueue) Swap(i, j int) {
+	queue.items[i], queue.items[j] = queue.items[j], queue.items[i]
+	queue.index[queue.items[i].id] = i
+	queue.index[queue.items[j].id] = j
+}
+
+func (queue *taskQueue) Push(x interface{}) {
+	item := x.(queueItem)
+	queue.index[item.id] = len(queue.items)
+	queue.items = append(queue.items, item)
+}
+
+func (queue *taskQueue) Pop() interface{} {
+	last := len(queue.items) - 1
+	item := queue.items[last]
+	queue.items[last] = queueItem{}
+	queue.items = queue.items[:last]
+	delete(queue.index, item.id)
+	return item
+}
+
+// schedule adds the task to the queue, or moves it to its new position if it
+// is already queued and the time it's due changed.
+func (queue *taskQueue) schedule(task *task.Task) {
+	id := task.Hash()
+	if i, ok := queue.index[id]; ok {
+		queue.items[i].task = task
+		heap.Fix(queue, i)
+		return
+	}
+	heap.Push(queue, queueItem{id: id, task: task})
+}
+
+// remove takes the task with the given ID out of the queue.
+func (queue *taskQueue) remove(taskID task.ID) {
+	if i, ok := queue.index[taskID]; ok {
+		heap.Remove(queue, i)
+	}
+}
+
+// peek returns the task which is due first without removing it.
+func (queue *taskQueue) peek() (*task.Task, bool) {
+	if len(queue.items) == 0 {
+		return nil, false
+	}
+	return queue.items[0].task, true
+}
+
+// popDue removes and returns the first task if it is due at now.
+func (queue *taskQueue) popDue(now time.Time) (*task.Task, bool) {
+	next, ok := queue.peek()
+	if !ok || next.DueAt().After(now) {
+		return nil, false
+	}
+	return heap.Pop(queue).(queueItem).task, true
+}
@@ -0,0 +1,83 @@
+package scheduler
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/config"
+	"github.com/ClubNFT/scheduler/task"
+)
+
+func newQueuedTask(name string, nextRun time.Time) *task.Task {
+	return task.NewWithSchedule(task.FunctionMeta{Name: name}, nil, task.Schedule{
+		NextRun: nextRun,
+	}, config.FunctionManager{})
+}
+
+func TestQueueOrder(t *testing.T) {
+	now := time.Now()
+	queue := newTaskQueue()
+	queue.schedule(newQueuedTask("third", now.Add(3*time.Second)))
+	queue.schedule(newQueuedTask("first", now.Add(1*time.Second)))
+	queue.schedule(newQueuedTask("second", now.Add(2*time.Second)))
+
+	for _, expected := range []string{"first", "second", "third"} {
+		next, ok := queue.popDue(now.Add(time.Minute))
+		if !ok || next.Func.Name != expected {
+			t.Errorf("Expected %s to be popped next", expected)
+		}
+	}
+	if _, ok := queue.peek(); ok {
+		t.Error("Queue should be empty")
+	}
+}
+
+func TestQueuePopDue(t *testing.T) {
+	now := time.Now()
+	queue := newTaskQueue()
+	queue.schedule(newQueuedTask("due", now.Add(-time.Second)))
+	queue.schedule(newQueuedTask("later", now.Add(time.Hour)))
+
+	if next, ok := queue.popDue(now); !ok || next.Func.Name != "due" {
+		t.Error("The due task should be popped")
+	}
+	if _, ok := queue.popDue(now); ok {
+		t.Error("A task which is not due should not be popped")
+	}
+	if queue.Len() != 1 {
+		t.Error("The task which is not due should still be queued")
+	}
+}
+
+func TestQueueReschedule(t *testing.T) {
+	now := time.Now()
+	queue := newTaskQueue()
+	first := newQueuedTask("first", now.Add(time.Second))
+	queue.schedule(first)
+	queue.schedule(newQueuedTask("second", now.Add(2*time.Second)))
+
+	first.NextRun = now.Add(3 * time.Second)
+	queue.schedule(first)
+
+	if queue.Len() != 2 {
+		t.Error("Rescheduling a queued task should not add it twice")
+	}
+	if next, _ := queue.peek(); next.Func.Name != "second" {
+		t.Error("The rescheduled task should have moved back")
+	}
+}
+
+func TestQueueRemove(t *testing.T) {
+	now := time.Now()
+	queue := newTaskQueue()
+	first := newQueuedTask("first", now.Add(time.Second))
+	queue.schedule(first)
+	queue.schedule(newQueuedTask("second", now.Add(2*time.Second)))
+
+	queue.remove(first.Hash())
+	queue.remove(task.ID("unknown"))
+
+	if next, _ := queue.peek(); queue.Len() != 1 || next.Func.Name != "second" {
+		t.Error("Only the removed task should have been taken out of the queue")
+	}
+}
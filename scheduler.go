@@ -4,11 +4,14 @@
 package scheduler
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"github.com/ClubNFT/scheduler/config"
 	"log"
 	"os"
 	"os/signal"
+	"sync"
 	"syscall"
 	"time"
 
@@ -17,96 +20,218 @@ import (
 )
 
 // Scheduler is used to schedule tasks. It holds information about those tasks
-// including metadata such as argument types and schedule times
+// including metadata such as argument types and schedule times.
+// All methods are safe for concurrent use.
 type Scheduler struct {
-	stopChan    chan bool
-	tasks       map[task.ID]*task.Task
+	wakeChan chan struct{}
+	// dispatchCtx is cancelled once the scheduler shuts down, no runs are started
+	// afterwards. ctx is the parent of the contexts passed to tasks, it's cancelled
+	// when the running tasks aren't waited for anymore.
+	dispatchCtx  context.Context
+	stopDispatch context.CancelFunc
+	ctx          context.Context
+	cancel       context.CancelFunc
+	// inflight counts the runs in progress. loopDone is closed when the scheduling
+	// loop exited and stopped once the scheduler shut down.
+	inflight     sync.WaitGroup
+	loopDone     chan struct{}
+	stopped      chan struct{}
+	shutdownOnce sync.Once
+
+	// closing is held for reading while a run which returned records its
+	// execution, Shutdown holds it while closing the task store.
+	closing sync.RWMutex
+
+	// completed holds the runs which returned and wait to be finished, see complete.
+	// It's guarded by completedMu, which may be locked while holding mu.
+	completedMu sync.Mutex
+	completed   []*completedRun
+
+	// mu guards tasks, queue, running, queuedRuns, pool, leased, closed and the task
+	// store.
+	mu      sync.Mutex
+	tasks   map[task.ID]*task.Task
+	queue   *taskQueue
+	running map[task.ID]map[*activeRun]struct{}
+	// queuedRuns holds the time runs were due which wait for the previous run
+	// of their task to finish, see task.OverlapQueue.
+	queuedRuns map[task.ID]time.Time
+	pool       workerPool
+	// closed is set once the task store was closed by Shutdown, runs which
+	// return afterwards don't update it.
+	closed      bool
 	taskStore   storeBridge
 	funcManager config.FunctionManager
+
+	executionHooks []func(Execution)
+
+	// With stores which implement storage.DueTaskStore, only the tasks due before
+	// loadedUntil are kept in memory. They're loaded lookahead ahead of time.
+	lookahead   time.Duration
+	loadedUntil time.Time
+
+	// With stores which implement storage.LeasingTaskStore, tasks are leased by
+	// leaseOwner for leaseDuration before they run. leased holds the tasks whose
+	// lease wasn't released yet.
+	leaseOwner    string
+	leaseDuration time.Duration
+	leased        map[task.ID]struct{}
+
+	// With leader election enabled, the store is polled every electionInterval
+	// and only the leader runs tasks.
+	electionInterval time.Duration
+	leading          bool
+	leadershipHooks  []func(bool)
+
+	history          storage.HistoryStore
+	historyRetention time.Duration
+
+	// shutdownTimeout is how long running tasks are waited for when the scheduler
+	// shuts down on SIGINT or SIGTERM.
+	shutdownTimeout time.Duration
 }
 
+const (
+	// defaultLookahead is how far ahead due tasks are loaded, see WithLookahead.
+	defaultLookahead = time.Minute
+	// defaultLeaseDuration is how long tasks are leased, see WithLeaseDuration.
+	defaultLeaseDuration = 30 * time.Second
+	// defaultShutdownTimeout is how long running tasks are waited for on SIGINT or
+	// SIGTERM, see WithShutdownTimeout.
+	defaultShutdownTimeout = 30 * time.Second
+	// dueTaskPageSize is the maximum number of due tasks loaded at once.
+	dueTaskPageSize = 1000
+	// dueTaskRetryInterval is the time after which loading due tasks is retried
+	// when it failed.
+	dueTaskRetryInterval = time.Second
+)
+
+// clearBefore is later than any task is due, it's used to page through all stored
+// tasks when clearing them.
+var clearBefore = time.Date(9999, time.December, 31, 0, 0, 0, 0, time.UTC)
+
 // New will return a new instance of the Scheduler struct.
-func New(store storage.TaskStore, stubStorage config.StubMapping) Scheduler {
+// Stores which implement the deprecated storage.TaskStore can be passed through
+// storage.AdaptTaskStore.
+func New(store storage.ContextTaskStore, stubStorage config.StubMapping, options ...Option) *Scheduler {
 	funcManager := *config.NewFunctionManager(stubStorage)
-	return Scheduler{
-		stopChan: make(chan bool),
-		tasks:    make(map[task.ID]*task.Task),
+	dispatchCtx, stopDispatch := context.WithCancel(context.Background())
+	ctx, cancel := context.WithCancel(context.Background())
+	scheduler := &Scheduler{
+		wakeChan:     make(chan struct{}, 1),
+		dispatchCtx:  dispatchCtx,
+		stopDispatch: stopDispatch,
+		ctx:          ctx,
+		cancel:       cancel,
+		stopped:      make(chan struct{}),
+		tasks:        make(map[task.ID]*task.Task),
+		queue:        newTaskQueue(),
+		running:      make(map[task.ID]map[*activeRun]struct{}),
+		queuedRuns:   make(map[task.ID]time.Time),
+		leased:       make(map[task.ID]struct{}),
 		taskStore: storeBridge{
 			store:       store,
 			funcManager: funcManager,
 		},
-		funcManager: funcManager,
+		funcManager:     funcManager,
+		lookahead:       defaultLookahead,
+		leaseOwner:      defaultLeaseOwner(),
+		leaseDuration:   defaultLeaseDuration,
+		shutdownTimeout: defaultShutdownTimeout,
+	}
+	for _, option := range options {
+		option(scheduler)
 	}
+	return scheduler
 }
 
 // RunAt will schedule function to be executed once at the given time.
-func (scheduler *Scheduler) RunAt(time time.Time, function task.Function, params ...string) (task.ID, error) {
-	meta, err := task.Translate(function)
-	if err != nil {
-		return "", err
-	}
-	task := task.New(meta, params, scheduler.funcManager)
-
-	task.NextRun = time
-
-	scheduler.registerTask(task)
-	err = scheduler.Refresh()
-	if err != nil {
-		return "", err
-	}
-	return task.Hash(), nil
+func (scheduler *Scheduler) RunAt(time time.Time, function task.Function, params ...task.Param) (task.ID, error) {
+	return scheduler.With().RunAt(time, function, params...)
 }
 
 // RunAfter executes function once after a specific duration has elapsed.
-func (scheduler *Scheduler) RunAfter(duration time.Duration, function task.Function, params ...string) (task.ID, error) {
-	return scheduler.RunAt(time.Now().Add(duration), function, params...)
+func (scheduler *Scheduler) RunAfter(duration time.Duration, function task.Function, params ...task.Param) (task.ID, error) {
+	return scheduler.With().RunAfter(duration, function, params...)
 }
 
 // RunEvery will schedule function to be executed every time the duration has elapsed.
-func (scheduler *Scheduler) RunEvery(duration time.Duration, function task.Function, params ...string) (task.ID, error) {
-	meta, err := task.Translate(function)
-	if err != nil {
-		return "", err
-	}
-	task := task.New(meta, params, scheduler.funcManager)
-
-	task.IsRecurring = true
-	task.Duration = duration
-	task.NextRun = time.Now().Add(duration)
-
-	scheduler.registerTask(task)
-	err = scheduler.Refresh()
-	if err != nil {
-		return "", err
-	}
+func (scheduler *Scheduler) RunEvery(duration time.Duration, function task.Function, params ...task.Param) (task.ID, error) {
+	return scheduler.With().RunEvery(duration, function, params...)
+}
 
-	return task.Hash(), nil
+// RunCron will schedule function to be executed whenever the cron expression matches.
+// Both 5-field and 6-field (with leading seconds) expressions are supported, as well
+// as macros such as @hourly and @daily.
+func (scheduler *Scheduler) RunCron(expr string, function task.Function, params ...task.Param) (task.ID, error) {
+	return scheduler.With().RunCron(expr, function, params...)
 }
 
 // Start will run the scheduler's timer and will trigger the execution
 // of tasks depending on their schedule.
 func (scheduler *Scheduler) Start() error {
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
+	if _, ok := scheduler.taskStore.store.(storage.LeaderElector); scheduler.electionInterval > 0 && !ok {
+		return fmt.Errorf("Leader election requires a store which implements storage.LeaderElector")
+	}
 
 	// Populate tasks from storage
 	err := scheduler.Refresh()
 	if err != nil {
 		return err
 	}
+	if err := scheduler.subscribe(); err != nil {
+		return err
+	}
+	if scheduler.electionInterval > 0 {
+		scheduler.elect()
+	}
 
+	scheduler.mu.Lock()
+	scheduler.loopDone = make(chan struct{})
 	scheduler.runPending()
+	scheduler.mu.Unlock()
 
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
 	go func() {
-		ticker := time.NewTicker(1 * time.Second)
+		defer close(scheduler.loopDone)
+		defer signal.Stop(sigChan)
+		// The timer is always armed for the task which is due first, so the
+		// loop only wakes up when there is work to do or the queue changed.
+		timer := time.NewTimer(0)
+		// Standbys poll the store to find out when they become the leader.
+		var electionTicks <-chan time.Time
+		if scheduler.electionInterval > 0 {
+			electionTicker := time.NewTicker(scheduler.electionInterval)
+			defer electionTicker.Stop()
+			electionTicks = electionTicker.C
+		}
+		var pruneTicks <-chan time.Time
+		if interval := scheduler.historyPruneInterval(); interval > 0 {
+			pruneTicker := time.NewTicker(interval)
+			defer pruneTicker.Stop()
+			pruneTicks = pruneTicker.C
+		}
 		for {
 			select {
-			case <-ticker.C:
+			case <-timer.C:
+				scheduler.mu.Lock()
 				scheduler.runPending()
+				scheduler.reloadDueTasks(time.Now())
+				scheduler.mu.Unlock()
+				scheduler.resetTimer(timer)
+			case <-scheduler.wakeChan:
+				scheduler.resetTimer(timer)
+			case <-electionTicks:
+				scheduler.elect()
+				scheduler.resetTimer(timer)
+			case <-pruneTicks:
+				scheduler.pruneHistory()
 			case <-sigChan:
-				scheduler.stopChan <- true
-			case <-scheduler.stopChan:
-				close(scheduler.stopChan)
+				go scheduler.shutdownOnSignal()
+			case <-scheduler.dispatchCtx.Done():
+				timer.Stop()
+				return
 			}
 		}
 	}()
@@ -114,7 +239,20 @@ func (scheduler *Scheduler) Start() error {
 	return nil
 }
 
+// Refresh synchronizes the registered tasks with the task store. With stores which
+// implement storage.DueTaskStore, only the tasks which are due soon are loaded.
 func (scheduler *Scheduler) Refresh() error {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	return scheduler.refresh()
+}
+
+func (scheduler *Scheduler) refresh() error {
+	if _, ok := scheduler.taskStore.dueStore(); ok {
+		return scheduler.loadDueTasks(time.Now())
+	}
+
 	// Populate tasks from storage
 	if err := scheduler.populateTasks(); err != nil {
 		return err
@@ -125,44 +263,88 @@ func (scheduler *Scheduler) Refresh() error {
 	return nil
 }
 
-// Stop will put the scheduler to halt
+// Stop will put the scheduler to halt. A leader resigns, so that a standby takes over. The contexts of running tasks are cancelled.
+// It doesn't wait for running tasks to return, see Shutdown.
 func (scheduler *Scheduler) Stop() {
-	scheduler.taskStore.store.Close()
-	scheduler.stopChan <- true
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_ = scheduler.Shutdown(ctx)
 }
 
 // Wait is a convenience function for blocking until the scheduler is stopped.
 func (scheduler *Scheduler) Wait() {
-	<-scheduler.stopChan
+	<-scheduler.stopped
 }
 
 // Cancel is used to cancel the planned execution of a specific task using it's ID.
-// The ID is returned when the task was scheduled using RunAt, RunAfter or RunEvery
+// The ID is returned when the task was scheduled using RunAt, RunAfter or RunEvery.
+// If the task is running, the context passed to it is cancelled as well.
 func (scheduler *Scheduler) Cancel(taskID task.ID) error {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
+	wasRunning := scheduler.cancelRunning(taskID)
+	scheduler.cancelWaiting(taskID)
 	task, found := scheduler.tasks[taskID]
 	if !found {
+		if wasRunning {
+			return nil
+		}
+		if _, ok := scheduler.taskStore.dueStore(); ok {
+			// Tasks which aren't due soon are only stored.
+			return scheduler.cancelStored(taskID)
+		}
 		return fmt.Errorf("Task not found")
 	}
 
-	_ = scheduler.taskStore.Remove(task)
+	_ = scheduler.taskStore.Remove(context.Background(), task)
 	delete(scheduler.tasks, taskID)
+	delete(scheduler.queuedRuns, taskID)
+	scheduler.queue.remove(taskID)
+	scheduler.wake()
 	return nil
 }
 
 // Clear will cancel the execution and clear all registered tasks.
 func (scheduler *Scheduler) Clear() {
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+
 	for taskID, currentTask := range scheduler.tasks {
-		_ = scheduler.taskStore.Remove(currentTask)
+		_ = scheduler.taskStore.Remove(context.Background(), currentTask)
 		delete(scheduler.tasks, taskID)
+		delete(scheduler.queuedRuns, taskID)
+		scheduler.cancelWaiting(taskID)
+		scheduler.queue.remove(taskID)
 	}
+	if store, ok := scheduler.taskStore.dueStore(); ok {
+		// Tasks which aren't due soon are only stored.
+		for {
+			tasks, err := store.FetchDue(context.Background(), clearBefore, dueTaskPageSize)
+			if err != nil || len(tasks) == 0 {
+				break
+			}
+			for _, attributes := range tasks {
+				if err := store.Remove(context.Background(), attributes); err != nil {
+					log.Printf("Error while clearing task %s: %v", attributes.Hash, err)
+					return
+				}
+			}
+		}
+	}
+	scheduler.wake()
 }
 
 func (scheduler *Scheduler) populateTasks() error {
-	tasks, err := scheduler.taskStore.Fetch()
+	tasks, err := scheduler.taskStore.Fetch(context.Background())
 	if err != nil {
 		return err
 	}
+	scheduler.registerStoredTasks(tasks)
+	return nil
+}
 
+func (scheduler *Scheduler) registerStoredTasks(tasks []*task.Task) {
 	for _, dbTask := range tasks {
 		//// If we can't find the function, it's been changed/removed by user
 		//exists := scheduler.funcRegistry.Exists(dbTask.Func.Name)
@@ -181,49 +363,272 @@ func (scheduler *Scheduler) populateTasks() error {
 				dbTask.Func.Name)
 			//dbTask.Func, _ = scheduler.funcRegistry.Get(dbTask.Func.Name)
 			registeredTask = dbTask
-			scheduler.tasks[dbTask.Hash()] = registeredTask
+			scheduler.registerTask(registeredTask)
 		}
 
 		// Duration may have changed for recurring tasks
 		if dbTask.IsRecurring && registeredTask.Duration != dbTask.Duration {
 			// Reschedule NextRun based on dbTask.LastRun + registeredTask.Duration
 			registeredTask.NextRun = dbTask.LastRun.Add(registeredTask.Duration)
+			scheduler.registerTask(registeredTask)
+		}
+	}
+}
+
+// loadDueTasks loads the tasks which are due within the lookahead and drops the
+// other ones from memory, they're loaded again once they're due soon.
+// Only used with stores which implement storage.DueTaskStore.
+func (scheduler *Scheduler) loadDueTasks(now time.Time) error {
+	before := now.Add(scheduler.lookahead)
+	tasks, err := scheduler.taskStore.FetchDue(context.Background(), before, dueTaskPageSize)
+	if err != nil {
+		return err
+	}
+	if len(tasks) == dueTaskPageSize {
+		// More tasks are due than fit into a page, the remaining ones are
+		// loaded once these ran.
+		before = earliestRun(tasks[len(tasks)-1])
+	}
+	scheduler.loadedUntil = before
+
+	// Tasks which weren't fetched were removed, or rescheduled after the window.
+	fetched := make(map[task.ID]bool, len(tasks))
+	for _, t := range tasks {
+		fetched[t.Hash()] = true
+	}
+	for taskID := range scheduler.tasks {
+		if _, running := scheduler.running[taskID]; !running && !fetched[taskID] {
+			delete(scheduler.tasks, taskID)
+			scheduler.queue.remove(taskID)
 		}
 	}
+	scheduler.registerStoredTasks(tasks)
+	scheduler.wake()
 	return nil
 }
 
+// reloadDueTasks loads the tasks which are due next once the loaded ones are due.
+func (scheduler *Scheduler) reloadDueTasks(now time.Time) {
+	if _, ok := scheduler.taskStore.dueStore(); !ok || now.Before(scheduler.loadedUntil) {
+		return
+	}
+	if err := scheduler.loadDueTasks(now); err != nil {
+		log.Printf("Error while loading due tasks: %v", err)
+		scheduler.loadedUntil = now.Add(dueTaskRetryInterval)
+	}
+}
+
+// addDueTask stores the task, and keeps it in memory if it's registered or due before
+// the loaded tasks end. Only used with stores which implement storage.DueTaskStore.
+func (scheduler *Scheduler) addDueTask(t *task.Task) error {
+	err := scheduler.taskStore.Add(context.Background(), t)
+	if err != nil && !errors.Is(err, storage.ErrConflict) {
+		return err
+	}
+	if _, registered := scheduler.tasks[t.Hash()]; registered || t.DueAt().Before(scheduler.loadedUntil) {
+		scheduler.registerTask(t)
+	}
+	return nil
+}
+
+// cancelStored removes a task which isn't kept in memory from the store.
+func (scheduler *Scheduler) cancelStored(taskID task.ID) error {
+	stored, err := scheduler.taskStore.FetchByHash(context.Background(), taskID)
+	if errors.Is(err, storage.ErrNotFound) {
+		return fmt.Errorf("Task not found")
+	}
+	if err != nil {
+		return err
+	}
+	return scheduler.taskStore.Remove(context.Background(), stored)
+}
+
+// earliestRun returns the earlier of the task's next run and retry, which stores
+// order due tasks by.
+func earliestRun(t *task.Task) time.Time {
+	if !t.RetryAt.IsZero() && t.RetryAt.Before(t.NextRun) {
+		return t.RetryAt
+	}
+	return t.NextRun
+}
+
 func (scheduler *Scheduler) persistRegisteredTasks() error {
 	for _, task := range scheduler.tasks {
-		err := scheduler.taskStore.Add(task)
-		if err != nil {
+		// Tasks which were fetched from the store are already stored.
+		err := scheduler.taskStore.Add(context.Background(), task)
+		if err != nil && !errors.Is(err, storage.ErrConflict) {
 			return err
 		}
 	}
 	return nil
 }
 
+// runPending runs the tasks which are due. The scheduler's lock must be held by the
+// caller, it's released while the due tasks are leased, see leaseDue.
 func (scheduler *Scheduler) runPending() {
-	for _, task := range scheduler.tasks {
-		if task.IsDue() {
+	if !scheduler.leads() || scheduler.dispatchCtx.Err() != nil {
+		return
+	}
 
+	// Collect due tasks before rescheduling them, so that a recurring task
+	// runs at most once per call even if its next run is already due.
+	// Only as many tasks are collected as the worker pool has room for, the
+	// others stay scheduled until a run finished.
+	var dueTasks []*task.Task
+	now := time.Now()
+	room := scheduler.pool.room()
+	for room < 0 || len(dueTasks) < room {
+		task, ok := scheduler.queue.popDue(now)
+		if !ok {
+			break
+		}
+		dueTasks = append(dueTasks, task)
+	}
+
+	leases := scheduler.leaseDue(dueTasks, now)
+	heldBack := false
+	for i, task := range dueTasks {
+		taskID := task.Hash()
+		if scheduler.tasks[taskID] != task {
+			// The task was cancelled or replaced while it was leased.
+			if leases[i] {
+				scheduler.releaseLease(taskID)
+			}
+			continue
+		}
+		if !scheduler.pool.admits(task.Func.Name) {
+			// The function runs as often as it may at once.
+			scheduler.queue.schedule(task)
+			if leases[i] {
+				scheduler.releaseLease(taskID)
+			}
+			heldBack = true
+			continue
+		}
+		leased := leases[i]
+		isRetry := !task.RetryAt.IsZero() && task.DueAt().Equal(task.RetryAt)
+		if !isRetry && !task.HandleMisfire(now) {
+			scheduler.dropMissedRun(task, leased)
+			continue
+		}
+
+		scheduledAt := task.DueAt()
+		if isRetry {
+			// The retry of a failed run keeps the attempt counter.
+			task.RetryAt = time.Time{}
+		} else {
 			// Reschedule task first to prevent running the task
 			// again in case the execution time takes more than the
 			// task's duration value.
+			task.ResetRetry()
 			task.ScheduleNextRun()
+		}
+		ended := task.Ended()
+		if ended {
+			log.Printf("The schedule of function %s has no runs left, it will be removed", task.Func.Name)
+		}
 
-			go task.Run()
-
-			if !task.IsRecurring {
-				_ = scheduler.taskStore.Remove(task)
-				delete(scheduler.tasks, task.Hash())
+		if !leased {
+			// Another scheduler runs the task and stores its state, it's only
+			// rescheduled here.
+			if task.IsRecurring && !ended {
+				scheduler.queue.schedule(task)
 			} else {
-				_ = scheduler.taskStore.Update(task)
+				delete(scheduler.tasks, taskID)
 			}
+			continue
+		}
+
+		// One-off tasks are removed once their execution finished, so
+		// that they can be retried if it fails.
+		if !scheduler.holdOverlappingRun(task, scheduledAt) {
+			scheduler.execute(task, scheduledAt)
 		}
+
+		switch {
+		case ended:
+			// The last run isn't retried.
+			delete(scheduler.tasks, taskID)
+			_ = scheduler.taskStore.Remove(context.Background(), task)
+			continue
+		case task.IsRecurring:
+			scheduler.queue.schedule(task)
+		}
+		_ = scheduler.taskStore.Update(context.Background(), task)
+	}
+
+	// Tasks which are still due wait for a run to finish if the pool is full,
+	// otherwise they're collected right away by the next call.
+	next, ok := scheduler.queue.peek()
+	scheduler.pool.saturated = ok && !next.DueAt().After(now) && (heldBack || scheduler.pool.room() == 0)
+}
+
+// dropMissedRun reschedules a task whose missed runs were dropped by its misfire
+// policy, one-off tasks and tasks whose schedule ended are removed.
+// The scheduler's lock must be held by the caller.
+func (scheduler *Scheduler) dropMissedRun(task *task.Task, leased bool) {
+	log.Printf("Dropped missed runs of function %s", task.Func.Name)
+	if task.IsRecurring && !task.Ended() {
+		task.ResetRetry()
+		scheduler.queue.schedule(task)
+		if leased {
+			_ = scheduler.taskStore.Update(context.Background(), task)
+		}
+	} else {
+		delete(scheduler.tasks, task.Hash())
+		if leased {
+			_ = scheduler.taskStore.Remove(context.Background(), task)
+		}
+	}
+	if leased {
+		scheduler.releaseLease(task.Hash())
 	}
 }
 
 func (scheduler *Scheduler) registerTask(task *task.Task) {
 	scheduler.tasks[task.Hash()] = task
+	scheduler.queue.schedule(task)
+	scheduler.wake()
+}
+
+// wake notifies the scheduling loop that the queue changed, so that its timer
+// is re-armed for the task which is now due first.
+func (scheduler *Scheduler) wake() {
+	select {
+	case scheduler.wakeChan <- struct{}{}:
+	default:
+	}
+}
+
+// resetTimer arms timer to fire when the first queued task is due. The timer
+// is left stopped when the queue is empty.
+func (scheduler *Scheduler) resetTimer(timer *time.Timer) {
+	if !timer.Stop() {
+		select {
+		case <-timer.C:
+		default:
+		}
+	}
+
+	scheduler.mu.Lock()
+	defer scheduler.mu.Unlock()
+	if !scheduler.leads() {
+		// Standbys don't run tasks, they're woken up by the election.
+		return
+	}
+	var wakeAt time.Time
+	if next, ok := scheduler.queue.peek(); ok {
+		wakeAt = next.DueAt()
+		if scheduler.pool.saturated && !wakeAt.After(time.Now()) {
+			// Due tasks wait for a run to finish, which wakes the loop.
+			wakeAt = time.Time{}
+		}
+	}
+	if _, ok := scheduler.taskStore.dueStore(); ok && (wakeAt.IsZero() || scheduler.loadedUntil.Before(wakeAt)) {
+		// Wake up to load the tasks which are due next.
+		wakeAt = scheduler.loadedUntil
+	}
+	if !wakeAt.IsZero() {
+		timer.Reset(time.Until(wakeAt))
+	}
 }
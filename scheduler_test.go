@@ -1,20 +1,105 @@
 package scheduler
 
 import (
+	"context"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/ClubNFT/scheduler/config"
 	"github.com/ClubNFT/scheduler/storage"
 	"github.com/ClubNFT/scheduler/task"
 )
 
 const TestTaskName = "github.com/ClubNFT/scheduler/task.(*CallbackMock).CallNoArgs-fm"
 
+// mockStubs registers the given functions under their Go names.
+func mockStubs(functions ...task.Function) config.StubMapping {
+	stubs := config.StubMapping{}
+	for _, function := range functions {
+		if funcMeta, err := task.Translate(function); err == nil {
+			stubs[funcMeta.Name] = function
+		}
+	}
+	return stubs
+}
+
+// startScheduler returns a started scheduler, which is stopped once the test finished.
+func startScheduler(t *testing.T, store storage.ContextTaskStore, stubs config.StubMapping, options ...Option) *Scheduler {
+	t.Helper()
+	scheduler := New(store, stubs, options...)
+	if err := scheduler.Start(); err != nil {
+		t.Fatal("Failed to start scheduler: ", err)
+	}
+	t.Cleanup(scheduler.Stop)
+	return scheduler
+}
+
+// callCounter counts the calls of count, which is registered through mockStubs.
+type callCounter struct {
+	calls int32
+}
+
+func (counter *callCounter) count() {
+	atomic.AddInt32(&counter.calls, 1)
+}
+
+func (counter *callCounter) Calls() int32 {
+	return atomic.LoadInt32(&counter.calls)
+}
+
+// runTracker counts the calls of run and how many of them were in progress at once.
+// The runs block until they're released.
+type runTracker struct {
+	mu                       sync.Mutex
+	calls, active, maxActive int
+	release                  chan struct{}
+}
+
+func newRunTracker() *runTracker {
+	return &runTracker{release: make(chan struct{})}
+}
+
+// run blocks until it's released or ctx is done, name tells its tasks apart.
+func (tracker *runTracker) run(ctx context.Context, name string) {
+	tracker.mu.Lock()
+	tracker.calls++
+	tracker.active++
+	if tracker.active > tracker.maxActive {
+		tracker.maxActive = tracker.active
+	}
+	tracker.mu.Unlock()
+
+	select {
+	case <-tracker.release:
+	case <-ctx.Done():
+	}
+
+	tracker.mu.Lock()
+	tracker.active--
+	tracker.mu.Unlock()
+}
+
+func (tracker *runTracker) counts() (calls, maxActive int) {
+	tracker.mu.Lock()
+	defer tracker.mu.Unlock()
+	return tracker.calls, tracker.maxActive
+}
+
+// waitForCalls waits up to a second until run was called expected times.
+func (tracker *runTracker) waitForCalls(expected int) {
+	deadline := time.Now().Add(time.Second)
+	for calls, _ := tracker.counts(); calls < expected && time.Now().Before(deadline); calls, _ = tracker.counts() {
+		time.Sleep(time.Millisecond)
+	}
+}
+
 func TestRunAt(t *testing.T) {
 	mock := task.CallbackMock{}
 
 	timeNow := time.Now()
-	scheduler := New(storage.NewMemoryStorage())
+	scheduler := New(storage.NewMemoryStorage(), mockStubs(mock.CallNoArgs))
 	taskID, err := scheduler.RunAt(timeNow, mock.CallNoArgs)
 	if err != nil {
 		t.Error("Creating a task should succeed")
@@ -36,7 +121,7 @@ func TestRunAt(t *testing.T) {
 
 func TestRunAfter(t *testing.T) {
 	mock := task.CallbackMock{}
-	scheduler := New(storage.NewMemoryStorage())
+	scheduler := New(storage.NewMemoryStorage(), mockStubs(mock.CallNoArgs))
 	_, err := scheduler.RunAfter(5, mock.CallNoArgs)
 	if err != nil {
 		t.Error("Creating a task should succeed")
@@ -49,7 +134,7 @@ func TestRunAfter(t *testing.T) {
 
 func TestRunEvery(t *testing.T) {
 	mock := task.CallbackMock{}
-	scheduler := New(storage.NewMemoryStorage())
+	scheduler := New(storage.NewMemoryStorage(), mockStubs(mock.CallNoArgs))
 	taskID, err := scheduler.RunEvery(5, mock.CallNoArgs)
 	if err != nil {
 		t.Error("Creating a task should succeed")
@@ -67,7 +152,7 @@ func TestRunEvery(t *testing.T) {
 
 func TestRunPending(t *testing.T) {
 	mock := task.CallbackMock{}
-	scheduler := New(storage.NewMemoryStorage())
+	scheduler := New(storage.NewMemoryStorage(), mockStubs(mock.CallNoArgs))
 	_, err := scheduler.RunAt(time.Now(), mock.CallNoArgs)
 	if err != nil {
 		t.Error("Creating a task should succeed")
@@ -75,12 +160,14 @@ func TestRunPending(t *testing.T) {
 
 	mock.On("CallNoArgs").Return()
 
+	scheduler.mu.Lock()
 	scheduler.runPending()
+	scheduler.mu.Unlock()
 
 	time.Sleep(100 * time.Millisecond)
 	mock.AssertExpectations(t)
 
-	if len(scheduler.tasks) > 0 {
+	if taskCount(scheduler) > 0 {
 		t.Error("Non-recurring task should be removed once executed")
 	}
 
@@ -90,10 +177,12 @@ func TestRunPending(t *testing.T) {
 	mock.On("CallNoArgs").Return()
 
 	// Task should be executed and then rescheduled
+	scheduler.mu.Lock()
 	scheduler.runPending()
+	scheduler.mu.Unlock()
 	time.Sleep(100 * time.Millisecond)
 	mock.AssertExpectations(t)
-	if len(scheduler.tasks) == 0 {
+	if taskCount(scheduler) == 0 {
 		t.Error("The recurring task should still exist")
 	}
 }
@@ -102,7 +191,7 @@ func TestStart(t *testing.T) {
 	mock := task.CallbackMock{}
 	mock.On("CallNoArgs").Return()
 
-	scheduler := New(storage.NewMemoryStorage())
+	scheduler := New(storage.NewMemoryStorage(), mockStubs(mock.CallNoArgs))
 	_, err := scheduler.RunAt(time.Now(), mock.CallNoArgs)
 	if err != nil {
 		t.Error("Should not fail")
@@ -120,8 +209,8 @@ func TestStart(t *testing.T) {
 }
 
 func TestCancelTask(t *testing.T) {
-	scheduler := New(storage.NewNoOpStorage())
 	mock := task.CallbackMock{}
+	scheduler := New(storage.NewMemoryStorage(), mockStubs(mock.CallNoArgs, mock.CallWithArgs))
 
 	err := scheduler.Cancel(task.ID("123456"))
 	if err == nil {
@@ -136,15 +225,15 @@ func TestCancelTask(t *testing.T) {
 }
 
 func TestClearTask(t *testing.T) {
-	scheduler := New(storage.NewNoOpStorage())
 	mock := task.CallbackMock{}
+	scheduler := New(storage.NewMemoryStorage(), mockStubs(mock.CallNoArgs, mock.CallWithArgs))
 
 	scheduler.RunAfter(5*time.Second, mock.CallNoArgs)
-	scheduler.RunAfter(5*time.Second, mock.CallWithArgs)
+	scheduler.RunAfter(5*time.Second, mock.CallWithArgs, "Hello", true)
 
 	scheduler.Clear()
 
-	if len(scheduler.tasks) > 0 {
+	if taskCount(scheduler) > 0 {
 		t.Error("Clearing tasks didn't take effect.")
 	}
 }
@@ -163,11 +252,174 @@ func TestPopulateTasks(t *testing.T) {
 	}
 
 	memStore := storage.NewMemoryStorage()
-	memStore.Add(taskAttributes)
-	scheduler := New(memStore)
+	memStore.Add(context.Background(), taskAttributes)
+	scheduler := New(memStore, mockStubs(mock.CallNoArgs))
 	scheduler.RunAfter(5, mock.CallNoArgs)
+	scheduler.mu.Lock()
 	err := scheduler.populateTasks()
+	scheduler.mu.Unlock()
 	if err != nil {
 		t.Error("Failed to populate tasks: ", err)
 	}
 }
+
+func TestStartSkipsTasksWhichCantBeLoaded(t *testing.T) {
+	mock := task.CallbackMock{}
+	memStore := storage.NewMemoryStorage()
+	_ = memStore.Add(context.Background(), storage.TaskAttributes{
+		Hash:        "RemovedFunction",
+		Name:        "github.com/ClubNFT/scheduler.removedFunction",
+		LastRun:     "2017-11-10T12:00:00Z",
+		NextRun:     "2017-11-10T12:00:00Z",
+		Duration:    "5s",
+		IsRecurring: "1",
+		Params:      "[]",
+	})
+	scheduler := New(memStore, mockStubs(mock.CallNoArgs))
+	if err := scheduler.Start(); err != nil {
+		t.Fatal("A stored task which can't be loaded should not fail the start: ", err)
+	}
+	defer scheduler.Stop()
+
+	if _, err := scheduler.RunAfter(time.Hour, mock.CallNoArgs); err != nil {
+		t.Error("Creating a task should succeed: ", err)
+	}
+	if taskCount(scheduler) != 1 {
+		t.Errorf("Only the task which could be loaded should be registered, found %d", taskCount(scheduler))
+	}
+}
+
+func TestRefreshStoredTasks(t *testing.T) {
+	mock := task.CallbackMock{}
+	scheduler := New(storage.NewMemoryStorage(), mockStubs(mock.CallNoArgs))
+	_, err := scheduler.RunAfter(5*time.Second, mock.CallNoArgs)
+	if err != nil {
+		t.Error("Creating a task should succeed")
+	}
+
+	if err := scheduler.Refresh(); err != nil {
+		t.Error("Refreshing tasks which are already stored should not fail: ", err)
+	}
+}
+
+func TestLegacyTaskStore(t *testing.T) {
+	mock := task.CallbackMock{}
+	scheduler := New(storage.AdaptTaskStore(&legacyStore{}), mockStubs(mock.CallNoArgs))
+	taskID, err := scheduler.RunAfter(5*time.Second, mock.CallNoArgs)
+	if err != nil {
+		t.Error("Scheduling with an adapted TaskStore should succeed: ", err)
+	}
+	if err := scheduler.Cancel(taskID); err != nil {
+		t.Error("Cancelling with an adapted TaskStore should succeed: ", err)
+	}
+}
+
+func TestDueTaskStoreKeepsDueTasks(t *testing.T) {
+	store := newDueStore()
+	scheduler := New(store, config.StubMapping{mockFunctionName: mockFunction}, WithLookahead(time.Minute))
+	if err := scheduler.Refresh(); err != nil {
+		t.Fatal("Loading due tasks should not fail: ", err)
+	}
+
+	if _, err := scheduler.RunAfter(time.Second, mockFunction, "soon"); err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	laterID, err := scheduler.RunAfter(time.Hour, mockFunction, "later")
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	if taskCount(scheduler) != 1 || store.Len() != 2 {
+		t.Errorf("Only the task due soon should be kept in memory, found %d of %d", taskCount(scheduler), store.Len())
+	}
+	if atomic.LoadInt32(&store.fetches) != 0 {
+		t.Error("Scheduling should not fetch all tasks")
+	}
+
+	if err := scheduler.Cancel(laterID); err != nil {
+		t.Error("Cancelling a stored task should succeed: ", err)
+	}
+	if err := scheduler.Cancel(laterID); err == nil {
+		t.Error("Cancelling a removed task should fail")
+	}
+	if store.Len() != 1 {
+		t.Error("Cancelling a task should remove it from the store")
+	}
+
+	_, _ = scheduler.RunAfter(time.Hour, mockFunction, "later")
+	scheduler.Clear()
+	if taskCount(scheduler) != 0 || store.Len() != 0 {
+		t.Error("Clearing should remove all tasks, including the ones not kept in memory")
+	}
+}
+
+func TestDueTaskStoreLoadsTasksWhenDue(t *testing.T) {
+	store := newDueStore()
+	executions := make(chan Execution, 1)
+	scheduler := New(store, config.StubMapping{mockFunctionName: mockFunction},
+		WithLookahead(10*time.Millisecond),
+		WithExecutionHook(func(execution Execution) { executions <- execution }))
+	if err := scheduler.Start(); err != nil {
+		t.Fatal("Failed to start scheduler: ", err)
+	}
+	defer scheduler.Stop()
+
+	if _, err := scheduler.RunAfter(100*time.Millisecond, mockFunction, "later"); err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	if taskCount(scheduler) != 0 {
+		t.Error("A task due after the lookahead should not be kept in memory")
+	}
+
+	select {
+	case execution := <-executions:
+		if execution.Params[0] != "later" {
+			t.Error("The stored task should have run")
+		}
+	case <-time.After(time.Second):
+		t.Fatal("The stored task should be loaded and run once it's due")
+	}
+	if atomic.LoadInt32(&store.fetches) != 0 {
+		t.Error("Loading due tasks should not fetch all tasks")
+	}
+}
+
+var endedCalls = make(chan struct{}, 2)
+
+func runEnded() {
+	endedCalls <- struct{}{}
+}
+
+func TestEndedScheduleIsRemoved(t *testing.T) {
+	scheduler := New(&lockedStore{t: t}, config.StubMapping{
+		"github.com/ClubNFT/scheduler.runEnded": runEnded,
+	})
+	meta, err := task.Translate(runEnded)
+	if err != nil {
+		t.Fatal("Translating the function should succeed: ", err)
+	}
+	// February 30th never comes, the due run is the last one.
+	ending := task.NewWithSchedule(meta, nil, task.Schedule{
+		IsRecurring: true,
+		NextRun:     time.Now(),
+		CronExpr:    "0 0 30 2 *",
+	}, scheduler.funcManager)
+
+	scheduler.mu.Lock()
+	scheduler.registerTask(ending)
+	scheduler.runPending()
+	scheduler.runPending()
+	scheduler.mu.Unlock()
+
+	select {
+	case <-endedCalls:
+	case <-time.After(time.Second):
+		t.Fatal("The last run of the task should run")
+	}
+	if taskCount(scheduler) != 0 {
+		t.Error("A task whose schedule ended should be removed")
+	}
+	scheduler.Stop()
+	if len(endedCalls) != 0 {
+		t.Error("A task whose schedule ended should not run again")
+	}
+}
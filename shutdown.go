@@ -0,0 +1,125 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/ClubNFT/scheduler/storage"
+	"github.com/ClubNFT/scheduler/task"
+)
+
+// WithShutdownTimeout sets how long running tasks are waited for when the scheduler
+// shuts down on SIGINT or SIGTERM, the default is 30 seconds. See Shutdown.
+func WithShutdownTimeout(timeout time.Duration) Option {
+	return func(scheduler *Scheduler) {
+		scheduler.shutdownTimeout = timeout
+	}
+}
+
+// Shutdown stops the scheduler gracefully. No runs are started anymore, and the
+// running tasks are waited for until ctx is done. Once it's done, the contexts of the
+// tasks still running are cancelled and they aren't waited for anymore. Their runs
+// don't update the task store or record their execution, one-off tasks among them run
+// again after a restart. The state of the tasks is persisted and the task store closed
+// last. A leader resigns, so that a standby takes over.
+//
+// Shutdown returns ctx.Err() if running tasks were given up on. Calls after the first
+// one wait until the scheduler stopped.
+func (scheduler *Scheduler) Shutdown(ctx context.Context) error {
+	first := false
+	scheduler.shutdownOnce.Do(func() { first = true })
+	if !first {
+		select {
+		case <-scheduler.stopped:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+
+	scheduler.stopDispatch()
+	scheduler.mu.Lock()
+	loopDone := scheduler.loopDone
+	scheduler.mu.Unlock()
+	if loopDone != nil {
+		<-loopDone
+	}
+
+	// Runs which didn't start yet are dropped, no runs start after this.
+	scheduler.mu.Lock()
+	for _, run := range scheduler.pool.waiting {
+		run.cancel()
+	}
+	scheduler.pool.waiting = nil
+	scheduler.queuedRuns = make(map[task.ID]time.Time)
+	scheduler.mu.Unlock()
+
+	drained := make(chan struct{})
+	go func() {
+		scheduler.inflight.Wait()
+		close(drained)
+	}()
+	var err error
+	select {
+	case <-drained:
+	case <-ctx.Done():
+		scheduler.mu.Lock()
+		running := len(scheduler.running)
+		scheduler.mu.Unlock()
+		if running > 0 {
+			err = ctx.Err()
+			log.Printf("Cancelling %d running tasks, they didn't finish before the shutdown: %v", running, err)
+		}
+	}
+	scheduler.cancel()
+
+	// Runs which are recording their execution are waited for, the ones returning
+	// later see the store closed.
+	scheduler.closing.Lock()
+	scheduler.mu.Lock()
+	scheduler.persistTasks()
+	resigned := scheduler.resign()
+	scheduler.closed = true
+	if closeErr := scheduler.taskStore.store.Close(); closeErr != nil && err == nil {
+		err = fmt.Errorf("Error while closing the task store: %w", closeErr)
+	}
+	scheduler.mu.Unlock()
+	scheduler.closing.Unlock()
+
+	if resigned {
+		scheduler.reportLeadership(false)
+	}
+	close(scheduler.stopped)
+	return err
+}
+
+// shutdownOnSignal shuts the scheduler down after it received SIGINT or SIGTERM,
+// waiting for the running tasks until the shutdown timeout expired.
+func (scheduler *Scheduler) shutdownOnSignal() {
+	ctx, cancel := context.WithTimeout(context.Background(), scheduler.shutdownTimeout)
+	defer cancel()
+	if err := scheduler.Shutdown(ctx); err != nil {
+		log.Printf("Error while shutting down: %v", err)
+	}
+}
+
+// persistTasks stores the final state of the registered tasks and releases their
+// leases. Only the leader stores tasks. If the store is shared with other schedulers,
+// only the tasks leased by this one are stored, the others may be behind the store.
+// The scheduler's lock must be held by the caller.
+func (scheduler *Scheduler) persistTasks() {
+	_, shared := scheduler.taskStore.leasingStore()
+	for taskID, t := range scheduler.tasks {
+		_, leased := scheduler.leased[taskID]
+		if scheduler.leads() && (!shared || leased) {
+			err := scheduler.taskStore.Update(context.Background(), t)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
+				log.Printf("Error while storing task %s: %v", taskID, err)
+			}
+		}
+		scheduler.releaseLease(taskID)
+	}
+}
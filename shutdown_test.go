@@ -0,0 +1,182 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"os"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/config"
+	"github.com/ClubNFT/scheduler/storage"
+	"github.com/ClubNFT/scheduler/task"
+)
+
+// closingStore fails the test if it's used after it was closed.
+type closingStore struct {
+	*storage.MemoryStorage
+	t      *testing.T
+	closed int32
+}
+
+func (store *closingStore) Update(ctx context.Context, task storage.TaskAttributes) error {
+	store.checkOpen()
+	return store.MemoryStorage.Update(ctx, task)
+}
+
+func (store *closingStore) Remove(ctx context.Context, task storage.TaskAttributes) error {
+	store.checkOpen()
+	return store.MemoryStorage.Remove(ctx, task)
+}
+
+func (store *closingStore) AddExecution(ctx context.Context, record storage.ExecutionRecord) error {
+	store.checkOpen()
+	return store.MemoryStorage.AddExecution(ctx, record)
+}
+
+func (store *closingStore) Close() error {
+	atomic.StoreInt32(&store.closed, 1)
+	return nil
+}
+
+func (store *closingStore) checkOpen() {
+	if atomic.LoadInt32(&store.closed) == 1 {
+		store.t.Error("Task store used after it was closed")
+	}
+}
+
+var drainedRuns = make(chan struct{}, 1)
+
+// runUntilDrained takes a while, or until it's cancelled.
+func runUntilDrained(ctx context.Context) error {
+	drainedRuns <- struct{}{}
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-time.After(50 * time.Millisecond):
+		return nil
+	}
+}
+
+func newShutdownScheduler(t *testing.T, blocker *blocker) (*Scheduler, *closingStore) {
+	store := &closingStore{MemoryStorage: storage.NewMemoryStorage(), t: t}
+	scheduler := startScheduler(t, store, mockStubs(runUntilDrained, blocker.block), WithHistory(store))
+	return scheduler, store
+}
+
+func TestShutdownWaitsForRunningTasks(t *testing.T) {
+	blocker := newBlocker()
+	scheduler, store := newShutdownScheduler(t, blocker)
+	taskID, err := scheduler.RunAt(time.Now(), runUntilDrained)
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	<-drainedRuns
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := scheduler.Shutdown(ctx); err != nil {
+		t.Fatal("Shutting down should succeed once the running tasks finished: ", err)
+	}
+	if scheduler.IsRunning(taskID) || store.Len() != 0 {
+		t.Error("The task should have finished and been removed before the store was closed")
+	}
+	if atomic.LoadInt32(&store.closed) != 1 {
+		t.Error("The task store should be closed")
+	}
+}
+
+func TestShutdownCancelsTasksAfterDeadline(t *testing.T) {
+	blocker := newBlocker()
+	scheduler, store := newShutdownScheduler(t, blocker)
+	if _, err := scheduler.RunAt(time.Now(), blocker.block); err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	<-blocker.calls
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	if err := scheduler.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Error("Shutting down should report the running tasks which were given up on, got: ", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+	if store.Len() != 1 {
+		t.Error("A one-off task which was cancelled by the shutdown should stay stored")
+	}
+}
+
+func TestShutdownPersistsLeasedTasks(t *testing.T) {
+	blocker := newBlocker()
+	scheduler, store := newShutdownScheduler(t, blocker)
+	leasedID, err := scheduler.RunAt(time.Now(), blocker.block)
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	<-blocker.calls
+	idleID, err := scheduler.RunAfter(time.Hour, runUntilDrained)
+	if err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+
+	later := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	scheduler.mu.Lock()
+	scheduler.tasks[leasedID].NextRun = later
+	scheduler.tasks[idleID].NextRun = later
+	scheduler.mu.Unlock()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	_ = scheduler.Shutdown(ctx)
+	for taskID, persisted := range map[task.ID]bool{leasedID: true, idleID: false} {
+		stored, _ := store.Get(string(taskID))
+		nextRun, _ := time.Parse(time.RFC3339, stored.NextRun)
+		if nextRun.Equal(later) != persisted {
+			t.Errorf("Only the state of the task leased by the scheduler should be persisted, task %s was stored with %s",
+				taskID, stored.NextRun)
+		}
+	}
+}
+
+func TestSignalWaitsForRunningTasks(t *testing.T) {
+	blocker := newBlocker()
+	scheduler, store := newShutdownScheduler(t, blocker)
+	if _, err := scheduler.RunAt(time.Now(), runUntilDrained); err != nil {
+		t.Fatal("Creating a task should succeed: ", err)
+	}
+	<-drainedRuns
+
+	if err := syscall.Kill(os.Getpid(), syscall.SIGTERM); err != nil {
+		t.Fatal("Sending SIGTERM should succeed: ", err)
+	}
+	stopped := make(chan struct{})
+	go func() {
+		scheduler.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("SIGTERM should shut the scheduler down")
+	}
+	if store.Len() != 0 {
+		t.Error("The running task should have finished and been removed before the scheduler stopped")
+	}
+}
+
+func TestStopWithoutStart(t *testing.T) {
+	scheduler := New(storage.NewMemoryStorage(), config.StubMapping{})
+	stopped := make(chan struct{})
+	go func() {
+		scheduler.Stop()
+		scheduler.Stop()
+		scheduler.Wait()
+		close(stopped)
+	}()
+	select {
+	case <-stopped:
+	case <-time.After(time.Second):
+		t.Fatal("Stopping a scheduler which wasn't started should not block")
+	}
+}
@@ -0,0 +1,47 @@
+package storage
+
+import "context"
+
+// AdaptTaskStore lets a TaskStore be used where a ContextTaskStore is expected.
+// The context is only checked before the store is called, and since a TaskStore
+// doesn't report missing or existing tasks, ErrNotFound and ErrConflict are
+// never returned.
+func AdaptTaskStore(store TaskStore) ContextTaskStore {
+	return &taskStoreAdapter{store: store}
+}
+
+type taskStoreAdapter struct {
+	store TaskStore
+}
+
+func (adapter *taskStoreAdapter) Add(ctx context.Context, task TaskAttributes) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return adapter.store.Add(task)
+}
+
+func (adapter *taskStoreAdapter) Update(ctx context.Context, task TaskAttributes) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return adapter.store.Update(task)
+}
+
+func (adapter *taskStoreAdapter) Fetch(ctx context.Context) ([]TaskAttributes, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return adapter.store.Fetch()
+}
+
+func (adapter *taskStoreAdapter) Remove(ctx context.Context, task TaskAttributes) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return adapter.store.Remove(task)
+}
+
+func (adapter *taskStoreAdapter) Close() error {
+	return adapter.store.Close()
+}
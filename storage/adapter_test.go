@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+// legacyStore is a TaskStore which records the calls made to it.
+type legacyStore struct {
+	calls []string
+}
+
+func (store *legacyStore) Add(TaskAttributes) error {
+	store.calls = append(store.calls, "Add")
+	return nil
+}
+
+func (store *legacyStore) Update(TaskAttributes) error {
+	store.calls = append(store.calls, "Update")
+	return nil
+}
+
+func (store *legacyStore) Remove(TaskAttributes) error {
+	store.calls = append(store.calls, "Remove")
+	return nil
+}
+
+func (store *legacyStore) Close() error { store.calls = append(store.calls, "Close"); return nil }
+
+func (store *legacyStore) Fetch() ([]TaskAttributes, error) {
+	store.calls = append(store.calls, "Fetch")
+	return []TaskAttributes{{Hash: "hash"}}, nil
+}
+
+func TestAdaptTaskStore(t *testing.T) {
+	ctx := context.Background()
+	legacy := &legacyStore{}
+	store := AdaptTaskStore(legacy)
+
+	_ = store.Add(ctx, TaskAttributes{})
+	_ = store.Update(ctx, TaskAttributes{})
+	tasks, err := store.Fetch(ctx)
+	_ = store.Remove(ctx, TaskAttributes{})
+	_ = store.Close()
+
+	if err != nil || len(tasks) != 1 || tasks[0].Hash != "hash" {
+		t.Error("Fetch should return the tasks of the adapted store")
+	}
+	expected := []string{"Add", "Update", "Fetch", "Remove", "Close"}
+	if len(legacy.calls) != len(expected) {
+		t.Fatalf("Every call should be passed on, got %v", legacy.calls)
+	}
+	for i, call := range expected {
+		if legacy.calls[i] != call {
+			t.Errorf("Expected %s to be called, got %s", call, legacy.calls[i])
+		}
+	}
+}
+
+func TestAdaptTaskStoreCancelledContext(t *testing.T) {
+	legacy := &legacyStore{}
+	store := AdaptTaskStore(legacy)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := store.Add(ctx, TaskAttributes{}); !errors.Is(err, context.Canceled) {
+		t.Error("Add should fail with a cancelled context, got: ", err)
+	}
+	if _, err := store.Fetch(ctx); !errors.Is(err, context.Canceled) {
+		t.Error("Fetch should fail with a cancelled context, got: ", err)
+	}
+	if len(legacy.calls) != 0 {
+		t.Error("The adapted store should not be called with a cancelled context")
+	}
+}
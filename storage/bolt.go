@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var boltBucket = []byte("scheduled_tasks")
+
+// BoltConfig configures the file storage.
+type BoltConfig struct {
+	// Path of the database file, it's created if it doesn't exist.
+	Path string
+	// LockTimeout is how long opening the file waits for another process to release it.
+	// Defaults to one second.
+	LockTimeout time.Duration
+	// CompactionInterval is how often the file is rewritten to give the space of removed
+	// tasks back to the file system. Zero disables periodic compaction.
+	CompactionInterval time.Duration
+}
+
+type boltStorage struct {
+	config BoltConfig
+	// mu guards db, which is replaced by Compact.
+	mu   sync.RWMutex
+	db   *bolt.DB
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewBoltStorage opens the file storage. Tasks are kept in a bbolt bucket keyed by their hash,
+// every change is committed in its own transaction, so a crash never leaves a partial write
+// behind. The file is locked while it's open, a second process trying to open it fails once
+// the LockTimeout has passed.
+func NewBoltStorage(config BoltConfig) (boltStore *boltStorage, err error) {
+	if config.LockTimeout == 0 {
+		config.LockTimeout = time.Second
+	}
+	boltStore = &boltStorage{config: config, stop: make(chan struct{}), done: make(chan struct{})}
+	boltStore.db, err = boltStore.open(config.Path)
+	if err != nil {
+		log.Printf("Unable to open DB : %s, error : %v", config.Path, err)
+		return nil, err
+	}
+	if config.CompactionInterval > 0 {
+		go boltStore.compactPeriodically()
+	} else {
+		close(boltStore.done)
+	}
+	return boltStore, nil
+}
+
+func (boltStore *boltStorage) open(path string) (*bolt.DB, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: boltStore.config.LockTimeout})
+	if err == bolt.ErrTimeout {
+		return nil, fmt.Errorf("Error while opening %s, it's locked by another process", path)
+	}
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(boltBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return db, nil
+}
+
+// Close stops the periodic compaction and releases the file.
+func (boltStore *boltStorage) Close() error {
+	select {
+	case <-boltStore.stop:
+	default:
+		close(boltStore.stop)
+	}
+	<-boltStore.done
+
+	boltStore.mu.Lock()
+	defer boltStore.mu.Unlock()
+	return boltStore.db.Close()
+}
+
+// Add stores the task unless a task with the same hash is already stored.
+func (boltStore *boltStorage) Add(ctx context.Context, task TaskAttributes) error {
+	return boltStore.update(ctx, func(bucket *bolt.Bucket) error {
+		if bucket.Get([]byte(task.Hash)) != nil {
+			return fmt.Errorf("%w: %s", ErrConflict, task.Hash)
+		}
+		return putTask(bucket, task)
+	})
+}
+
+// Update stores the run times and retry state of a task which is already stored.
+func (boltStore *boltStorage) Update(ctx context.Context, task TaskAttributes) error {
+	return boltStore.update(ctx, func(bucket *bolt.Bucket) error {
+		encoded := bucket.Get([]byte(task.Hash))
+		if encoded == nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, task.Hash)
+		}
+		var stored TaskAttributes
+		if err := json.Unmarshal(encoded, &stored); err != nil {
+			return err
+		}
+		stored.LastRun = task.LastRun
+		stored.NextRun = task.NextRun
+		stored.Attempt = task.Attempt
+		stored.RetryAt = task.RetryAt
+		return putTask(bucket, stored)
+	})
+}
+
+func (boltStore *boltStorage) Fetch(ctx context.Context) ([]TaskAttributes, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	boltStore.mu.RLock()
+	defer boltStore.mu.RUnlock()
+
+	var tasks []TaskAttributes
+	err := boltStore.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltBucket).ForEach(func(_, encoded []byte) error {
+			var task TaskAttributes
+			if err := json.Unmarshal(encoded, &task); err != nil {
+				return err
+			}
+			tasks = append(tasks, task)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("Error while fetching tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+func (boltStore *boltStorage) Remove(ctx context.Context, task TaskAttributes) error {
+	return boltStore.update(ctx, func(bucket *bolt.Bucket) error {
+		if bucket.Get([]byte(task.Hash)) == nil {
+			return fmt.Errorf("%w: %s", ErrNotFound, task.Hash)
+		}
+		return bucket.Delete([]byte(task.Hash))
+	})
+}
+
+// Compact rewrites the file without the space left behind by removed tasks. The compacted
+// copy is written next to the file and renamed over it, so the original stays intact until
+// the copy is complete.
+func (boltStore *boltStorage) Compact() error {
+	boltStore.mu.Lock()
+	defer boltStore.mu.Unlock()
+
+	stats := boltStore.db.Stats()
+	if stats.FreePageN+stats.PendingPageN == 0 {
+		return nil
+	}
+
+	path := boltStore.config.Path
+	compactPath := path + ".compact"
+	if err := os.Remove(compactPath); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	compacted, err := boltStore.open(compactPath)
+	if err != nil {
+		return err
+	}
+	err = boltStore.db.View(func(tx *bolt.Tx) error {
+		return compacted.Update(func(compactedTx *bolt.Tx) error {
+			bucket := compactedTx.Bucket(boltBucket)
+			return tx.Bucket(boltBucket).ForEach(bucket.Put)
+		})
+	})
+	if err == nil {
+		// The compacted file stays open, and therefore locked, while it replaces the
+		// original so that no other process can open the file in between.
+		err = os.Rename(compactPath, path)
+	}
+	if err != nil {
+		compacted.Close()
+		os.Remove(compactPath)
+		return fmt.Errorf("Error while compacting %s: %s", path, err)
+	}
+	syncDir(filepath.Dir(path))
+
+	boltStore.db.Close()
+	boltStore.db = compacted
+	return nil
+}
+
+func (boltStore *boltStorage) compactPeriodically() {
+	defer close(boltStore.done)
+	ticker := time.NewTicker(boltStore.config.CompactionInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := boltStore.Compact(); err != nil {
+				log.Printf("Couldn't compact the DB, error : %v", err)
+			}
+		case <-boltStore.stop:
+			return
+		}
+	}
+}
+
+// update runs fn in a write transaction on the tasks bucket, the transaction is
+// rolled back if fn fails. bbolt doesn't support contexts, so ctx is only checked
+// before the transaction starts.
+func (boltStore *boltStorage) update(ctx context.Context, fn func(bucket *bolt.Bucket) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	boltStore.mu.RLock()
+	defer boltStore.mu.RUnlock()
+
+	return boltStore.db.Update(func(tx *bolt.Tx) error {
+		return fn(tx.Bucket(boltBucket))
+	})
+}
+
+func putTask(bucket *bolt.Bucket, task TaskAttributes) error {
+	encoded, err := json.Marshal(task)
+	if err != nil {
+		return err
+	}
+	return bucket.Put([]byte(task.Hash), encoded)
+}
+
+// syncDir flushes the directory entry of a renamed file, failures are ignored since not
+// every platform supports syncing directories.
+func syncDir(path string) {
+	dir, err := os.Open(path)
+	if err != nil {
+		return
+	}
+	defer dir.Close()
+	_ = dir.Sync()
+}
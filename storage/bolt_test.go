@@ -0,0 +1,178 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newTestBoltStorage(t *testing.T, config BoltConfig) *boltStorage {
+	if config.Path == "" {
+		config.Path = filepath.Join(t.TempDir(), "tasks.db")
+	}
+	boltStore, err := NewBoltStorage(config)
+	if err != nil {
+		t.Fatal("Failed to open the file storage: ", err)
+	}
+	t.Cleanup(func() { boltStore.Close() })
+	return boltStore
+}
+
+func TestBoltStorageAdd(t *testing.T) {
+	ctx := context.Background()
+	boltStore := newTestBoltStorage(t, BoltConfig{})
+	_ = boltStore.Add(ctx, TaskAttributes{Hash: "first", Name: "First", Params: `["Hello"]`})
+	_ = boltStore.Add(ctx, TaskAttributes{Hash: "second", Name: "Second"})
+	if err := boltStore.Add(ctx, TaskAttributes{Hash: "first", Name: "Changed"}); !errors.Is(err, ErrConflict) {
+		t.Error("Adding a task with an existing hash should conflict, got: ", err)
+	}
+
+	tasks, err := boltStore.Fetch(ctx)
+	if err != nil || len(tasks) != 2 {
+		t.Fatal("Adding a task with an existing hash should not store it")
+	}
+	if tasks[0].Name != "First" || tasks[0].Params != `["Hello"]` {
+		t.Errorf("All attributes should be stored, found %+v", tasks[0])
+	}
+}
+
+func TestBoltStorageUpdate(t *testing.T) {
+	ctx := context.Background()
+	boltStore := newTestBoltStorage(t, BoltConfig{})
+	_ = boltStore.Add(ctx, TaskAttributes{Hash: "hash", Name: "Task", NextRun: "before", Duration: "5s"})
+	_ = boltStore.Update(ctx, TaskAttributes{Hash: "hash", Name: "Other", NextRun: "after", LastRun: "before", Duration: "1s",
+		Attempt: "2", RetryAt: "soon"})
+	if err := boltStore.Update(ctx, TaskAttributes{Hash: "unknown", NextRun: "after"}); !errors.Is(err, ErrNotFound) {
+		t.Error("Updating an unknown task should not find it, got: ", err)
+	}
+
+	tasks, err := boltStore.Fetch(ctx)
+	if err != nil || len(tasks) != 1 {
+		t.Fatal("Updating an unknown task should not add it")
+	}
+	task := tasks[0]
+	if task.NextRun != "after" || task.LastRun != "before" || task.Attempt != "2" || task.RetryAt != "soon" {
+		t.Error("Updating a task should store its run times and retry state")
+	}
+	if task.Name != "Task" || task.Duration != "5s" {
+		t.Error("Updating a task should leave its other attributes untouched")
+	}
+}
+
+func TestBoltStorageRemove(t *testing.T) {
+	ctx := context.Background()
+	boltStore := newTestBoltStorage(t, BoltConfig{})
+	_ = boltStore.Add(ctx, TaskAttributes{Hash: "first"})
+	_ = boltStore.Add(ctx, TaskAttributes{Hash: "second"})
+
+	if err := boltStore.Remove(ctx, TaskAttributes{Hash: "first"}); err != nil {
+		t.Error("Removing a task should not fail: ", err)
+	}
+	if err := boltStore.Remove(ctx, TaskAttributes{Hash: "unknown"}); !errors.Is(err, ErrNotFound) {
+		t.Error("Removing an unknown task should not find it, got: ", err)
+	}
+	tasks, _ := boltStore.Fetch(ctx)
+	if len(tasks) != 1 || tasks[0].Hash != "second" {
+		t.Error("Only the removed task should be gone")
+	}
+}
+
+func TestBoltStoragePersists(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	boltStore, err := NewBoltStorage(BoltConfig{Path: path})
+	if err != nil {
+		t.Fatal("Failed to open the file storage: ", err)
+	}
+	_ = boltStore.Add(ctx, TaskAttributes{Hash: "hash", Name: "Task"})
+	if err := boltStore.Close(); err != nil {
+		t.Error("Closing the storage should not fail: ", err)
+	}
+
+	reopened := newTestBoltStorage(t, BoltConfig{Path: path})
+	tasks, err := reopened.Fetch(ctx)
+	if err != nil || len(tasks) != 1 || tasks[0].Name != "Task" {
+		t.Error("Tasks should survive reopening the file")
+	}
+}
+
+func TestBoltStorageLocksFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	newTestBoltStorage(t, BoltConfig{Path: path})
+
+	if _, err := NewBoltStorage(BoltConfig{Path: path, LockTimeout: 50 * time.Millisecond}); err == nil {
+		t.Error("Opening a file which is already open should fail")
+	}
+}
+
+func TestBoltStorageCompact(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	boltStore := newTestBoltStorage(t, BoltConfig{Path: path})
+	params := fmt.Sprintf(`["%s"]`, strings.Repeat("x", 1024))
+	for i := 0; i < 1000; i++ {
+		_ = boltStore.Add(ctx, TaskAttributes{Hash: fmt.Sprint(i), Params: params})
+	}
+	for i := 1; i < 1000; i++ {
+		_ = boltStore.Remove(ctx, TaskAttributes{Hash: fmt.Sprint(i)})
+	}
+	before, _ := os.Stat(path)
+
+	if err := boltStore.Compact(); err != nil {
+		t.Fatal("Compacting should not fail: ", err)
+	}
+	after, _ := os.Stat(path)
+	if after.Size() >= before.Size() {
+		t.Errorf("Compacting should shrink the file, %d bytes before and %d after", before.Size(), after.Size())
+	}
+	if _, err := os.Stat(path + ".compact"); !os.IsNotExist(err) {
+		t.Error("The compacted copy should have replaced the file")
+	}
+
+	tasks, err := boltStore.Fetch(ctx)
+	if err != nil || len(tasks) != 1 || tasks[0].Hash != "0" || tasks[0].Params != params {
+		t.Error("Compacting should keep the stored tasks")
+	}
+	_ = boltStore.Add(ctx, TaskAttributes{Hash: "new"})
+	if tasks, _ := boltStore.Fetch(ctx); len(tasks) != 2 {
+		t.Error("The compacted file should be used afterwards")
+	}
+	if _, err := NewBoltStorage(BoltConfig{Path: path, LockTimeout: 50 * time.Millisecond}); err == nil {
+		t.Error("The compacted file should still be locked")
+	}
+}
+
+func TestBoltStorageCompactsPeriodically(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "tasks.db")
+	boltStore := newTestBoltStorage(t, BoltConfig{Path: path, CompactionInterval: 10 * time.Millisecond})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				task := TaskAttributes{Hash: fmt.Sprint(i, "-", j)}
+				if err := boltStore.Add(ctx, task); err != nil {
+					t.Error("Adding a task while compacting should not fail: ", err)
+				}
+				if j%2 == 0 {
+					_ = boltStore.Remove(ctx, task)
+				}
+				time.Sleep(time.Millisecond)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if tasks, err := boltStore.Fetch(ctx); err != nil || len(tasks) != 100 {
+		t.Errorf("Compacting should not lose tasks, found %d", len(tasks))
+	}
+}
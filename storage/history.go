@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"time"
+)
+
+// ExecutionOutcome is the outcome of a run of a task.
+type ExecutionOutcome string
+
+const (
+	// ExecutionSucceeded means that the function returned without an error.
+	ExecutionSucceeded ExecutionOutcome = "succeeded"
+	// ExecutionFailed means that the function returned an error.
+	ExecutionFailed ExecutionOutcome = "failed"
+	// ExecutionPanicked means that the function panicked.
+	ExecutionPanicked ExecutionOutcome = "panicked"
+)
+
+// ExecutionRecord describes a completed run of a task.
+// Params holds the JSON array of the task's params, Error the text of the error the
+// run failed with.
+type ExecutionRecord struct {
+	Hash        string
+	Name        string
+	Params      string
+	ScheduledAt time.Time
+	StartedAt   time.Time
+	FinishedAt  time.Time
+	Attempt     int
+	Outcome     ExecutionOutcome
+	Error       string
+}
+
+// HistoryFilter selects execution records. Zero values don't restrict the records.
+type HistoryFilter struct {
+	// Since and Until select the runs which started at or after Since and before Until.
+	Since time.Time
+	Until time.Time
+	// Outcome selects the runs with the given outcome.
+	Outcome ExecutionOutcome
+	// Limit is the maximum number of records returned.
+	Limit int
+}
+
+// HistoryStore is the interface to implement for recording the runs of tasks.
+// It has to be safe for concurrent use.
+type HistoryStore interface {
+	// AddExecution records a run of a task.
+	AddExecution(context.Context, ExecutionRecord) error
+	// FetchExecutions returns the records of the task with the given hash which match
+	// filter, the latest run first.
+	FetchExecutions(ctx context.Context, hash string, filter HistoryFilter) ([]ExecutionRecord, error)
+	// PruneExecutions removes the records of runs which finished before the given time
+	// and returns how many were removed.
+	PruneExecutions(ctx context.Context, before time.Time) (int, error)
+}
+
+// matches reports whether record is selected by filter, apart from its limit.
+func (filter HistoryFilter) matches(record ExecutionRecord) bool {
+	return (filter.Since.IsZero() || !record.StartedAt.Before(filter.Since)) &&
+		(filter.Until.IsZero() || record.StartedAt.Before(filter.Until)) &&
+		(filter.Outcome == "" || record.Outcome == filter.Outcome)
+}
@@ -0,0 +1,76 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+// testHistoryStore checks the behaviour shared by all HistoryStore implementations.
+func testHistoryStore(t *testing.T, history HistoryStore) {
+	ctx := context.Background()
+	start := time.Date(2017, 11, 10, 12, 0, 0, 0, time.UTC)
+	for i, outcome := range []ExecutionOutcome{ExecutionSucceeded, ExecutionFailed, ExecutionPanicked} {
+		startedAt := start.Add(time.Duration(i) * time.Minute)
+		err := history.AddExecution(ctx, ExecutionRecord{
+			Hash:        "hash",
+			Name:        "Task",
+			Params:      `["Hello"]`,
+			ScheduledAt: startedAt,
+			StartedAt:   startedAt,
+			FinishedAt:  startedAt.Add(time.Second),
+			Attempt:     i + 1,
+			Outcome:     outcome,
+			Error:       string(outcome),
+		})
+		if err != nil {
+			t.Fatal("Recording an execution should not fail: ", err)
+		}
+	}
+	_ = history.AddExecution(ctx, ExecutionRecord{Hash: "other", StartedAt: start, FinishedAt: start})
+
+	records, err := history.FetchExecutions(ctx, "hash", HistoryFilter{})
+	if err != nil || len(records) != 3 {
+		t.Fatalf("All executions of the task should be fetched, found %d: %v", len(records), err)
+	}
+	if records[0].Outcome != ExecutionPanicked || records[2].Outcome != ExecutionSucceeded {
+		t.Error("Executions should be fetched latest first")
+	}
+	if record := records[1]; record.Name != "Task" || record.Params != `["Hello"]` || record.Attempt != 2 ||
+		record.Error != "failed" || !record.ScheduledAt.Equal(start.Add(time.Minute)) ||
+		!record.FinishedAt.Equal(start.Add(time.Minute+time.Second)) {
+		t.Errorf("All attributes of an execution should be recorded, found %+v", record)
+	}
+
+	filtered, _ := history.FetchExecutions(ctx, "hash", HistoryFilter{
+		Since: start.Add(time.Minute),
+		Until: start.Add(2 * time.Minute),
+	})
+	if len(filtered) != 1 || filtered[0].Attempt != 2 {
+		t.Error("Only executions started within the filtered period should be fetched")
+	}
+	if filtered, _ := history.FetchExecutions(ctx, "hash", HistoryFilter{Outcome: ExecutionFailed}); len(filtered) != 1 {
+		t.Error("Only executions with the filtered outcome should be fetched")
+	}
+	if filtered, _ := history.FetchExecutions(ctx, "hash", HistoryFilter{Limit: 2}); len(filtered) != 2 ||
+		filtered[0].Attempt != 3 {
+		t.Error("At most the limit of the latest executions should be fetched")
+	}
+
+	pruned, err := history.PruneExecutions(ctx, start.Add(time.Minute+time.Second))
+	if err != nil || pruned != 2 {
+		t.Errorf("Executions finished before the given time should be pruned, pruned %d: %v", pruned, err)
+	}
+	if records, _ := history.FetchExecutions(ctx, "hash", HistoryFilter{}); len(records) != 2 {
+		t.Error("Executions finished after the given time should be kept")
+	}
+}
+
+func TestMemoryStorageHistory(t *testing.T) {
+	testHistoryStore(t, NewMemoryStorage())
+}
+
+func TestPostgresStorageHistory(t *testing.T) {
+	_, dbURL := newTestPostgresDB(t)
+	testHistoryStore(t, newTestPostgresStorage(t, dbURL))
+}
@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryStorage is a TaskStore which keeps tasks in memory, e.g. for tests or
+// for trying out the scheduler without a database. It's safe for concurrent use,
+// and it can be shared by schedulers within the same process as it implements
+// LeasingTaskStore. It also implements HistoryStore.
+type MemoryStorage struct {
+	mu    sync.RWMutex
+	tasks map[string]TaskAttributes
+	// order keeps the hashes in insertion order so that Fetch is deterministic.
+	order  []string
+	leases map[string]memoryLease
+	// executions are kept in the order they were added.
+	executions []ExecutionRecord
+}
+
+type memoryLease struct {
+	owner string
+	until time.Time
+}
+
+// NewMemoryStorage returns an empty MemoryStorage.
+func NewMemoryStorage() *MemoryStorage {
+	return &MemoryStorage{
+		tasks:  make(map[string]TaskAttributes),
+		leases: make(map[string]memoryLease),
+	}
+}
+
+// Add stores the task unless a task with the same hash is already stored.
+func (memStore *MemoryStorage) Add(ctx context.Context, task TaskAttributes) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	memStore.mu.Lock()
+	defer memStore.mu.Unlock()
+
+	if _, ok := memStore.tasks[task.Hash]; ok {
+		return fmt.Errorf("%w: %s", ErrConflict, task.Hash)
+	}
+	memStore.tasks[task.Hash] = task
+	memStore.order = append(memStore.order, task.Hash)
+	return nil
+}
+
+// Update stores the run times and retry state of a task which is already stored.
+// Like the Postgres store, other attributes are left untouched.
+func (memStore *MemoryStorage) Update(ctx context.Context, task TaskAttributes) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	memStore.mu.Lock()
+	defer memStore.mu.Unlock()
+
+	stored, ok := memStore.tasks[task.Hash]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, task.Hash)
+	}
+	stored.LastRun = task.LastRun
+	stored.NextRun = task.NextRun
+	stored.Attempt = task.Attempt
+	stored.RetryAt = task.RetryAt
+	memStore.tasks[task.Hash] = stored
+	return nil
+}
+
+// Fetch returns all stored tasks in the order they were added.
+func (memStore *MemoryStorage) Fetch(ctx context.Context) ([]TaskAttributes, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	return memStore.Snapshot(), nil
+}
+
+// Remove deletes the task with the same hash.
+func (memStore *MemoryStorage) Remove(ctx context.Context, task TaskAttributes) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	memStore.mu.Lock()
+	defer memStore.mu.Unlock()
+
+	if _, ok := memStore.tasks[task.Hash]; !ok {
+		return fmt.Errorf("%w: %s", ErrNotFound, task.Hash)
+	}
+	delete(memStore.tasks, task.Hash)
+	delete(memStore.leases, task.Hash)
+	for i, hash := range memStore.order {
+		if hash == task.Hash {
+			memStore.order = append(memStore.order[:i], memStore.order[i+1:]...)
+			break
+		}
+	}
+	return nil
+}
+
+// Lease claims the task for owner if it's due at now, comparing its stored times.
+func (memStore *MemoryStorage) Lease(ctx context.Context, hash, owner string, now, until time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	memStore.mu.Lock()
+	defer memStore.mu.Unlock()
+
+	task, ok := memStore.tasks[hash]
+	if !ok || !isDue(task, now) {
+		return fmt.Errorf("%w: %s", ErrNotLeased, hash)
+	}
+	if current, ok := memStore.leases[hash]; ok && current.owner != owner && !current.until.Before(now) {
+		return fmt.Errorf("%w: %s", ErrNotLeased, hash)
+	}
+	memStore.leases[hash] = memoryLease{owner: owner, until: until}
+	return nil
+}
+
+// RenewLease extends the lease held by owner.
+func (memStore *MemoryStorage) RenewLease(ctx context.Context, hash, owner string, until time.Time) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	memStore.mu.Lock()
+	defer memStore.mu.Unlock()
+
+	if current, ok := memStore.leases[hash]; !ok || current.owner != owner {
+		return fmt.Errorf("%w: %s", ErrNotLeased, hash)
+	}
+	memStore.leases[hash] = memoryLease{owner: owner, until: until}
+	return nil
+}
+
+// ReleaseLease ends the lease held by owner.
+func (memStore *MemoryStorage) ReleaseLease(ctx context.Context, hash, owner string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	memStore.mu.Lock()
+	defer memStore.mu.Unlock()
+
+	if current, ok := memStore.leases[hash]; ok && current.owner == owner {
+		delete(memStore.leases, hash)
+	}
+	return nil
+}
+
+// isDue reports whether the task's next run or retry is due at now. Tasks with
+// invalid times are never due.
+func isDue(task TaskAttributes, now time.Time) bool {
+	if nextRun, err := time.Parse(time.RFC3339, task.NextRun); err == nil && !nextRun.After(now) {
+		return true
+	}
+	retryAt, err := time.Parse(time.RFC3339, task.RetryAt)
+	return err == nil && !retryAt.After(now)
+}
+
+// AddExecution records a run of a task.
+func (memStore *MemoryStorage) AddExecution(ctx context.Context, record ExecutionRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	memStore.mu.Lock()
+	defer memStore.mu.Unlock()
+
+	memStore.executions = append(memStore.executions, record)
+	return nil
+}
+
+// FetchExecutions returns the matching records of the task, the latest run first.
+func (memStore *MemoryStorage) FetchExecutions(ctx context.Context, hash string, filter HistoryFilter) ([]ExecutionRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	memStore.mu.RLock()
+	defer memStore.mu.RUnlock()
+
+	var records []ExecutionRecord
+	for _, record := range memStore.executions {
+		if record.Hash == hash && filter.matches(record) {
+			records = append(records, record)
+		}
+	}
+	sort.SliceStable(records, func(i, j int) bool {
+		return records[i].StartedAt.After(records[j].StartedAt)
+	})
+	if filter.Limit > 0 && len(records) > filter.Limit {
+		records = records[:filter.Limit]
+	}
+	return records, nil
+}
+
+// PruneExecutions removes the records of runs which finished before the given time.
+func (memStore *MemoryStorage) PruneExecutions(ctx context.Context, before time.Time) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	memStore.mu.Lock()
+	defer memStore.mu.Unlock()
+
+	kept := memStore.executions[:0]
+	for _, record := range memStore.executions {
+		if !record.FinishedAt.Before(before) {
+			kept = append(kept, record)
+		}
+	}
+	pruned := len(memStore.executions) - len(kept)
+	memStore.executions = kept
+	return pruned, nil
+}
+
+// Close is a no-op, the stored tasks remain available.
+func (memStore *MemoryStorage) Close() error {
+	return nil
+}
+
+// Snapshot returns a copy of all stored tasks in the order they were added.
+func (memStore *MemoryStorage) Snapshot() []TaskAttributes {
+	memStore.mu.RLock()
+	defer memStore.mu.RUnlock()
+
+	tasks := make([]TaskAttributes, 0, len(memStore.order))
+	for _, hash := range memStore.order {
+		tasks = append(tasks, memStore.tasks[hash])
+	}
+	return tasks
+}
+
+// Get returns the stored task with the given hash.
+func (memStore *MemoryStorage) Get(hash string) (TaskAttributes, bool) {
+	memStore.mu.RLock()
+	defer memStore.mu.RUnlock()
+
+	task, ok := memStore.tasks[hash]
+	return task, ok
+}
+
+// Len returns the number of stored tasks.
+func (memStore *MemoryStorage) Len() int {
+	memStore.mu.RLock()
+	defer memStore.mu.RUnlock()
+
+	return len(memStore.tasks)
+}
@@ -0,0 +1,147 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestMemoryStorageAdd(t *testing.T) {
+	ctx := context.Background()
+	memStore := NewMemoryStorage()
+	_ = memStore.Add(ctx, TaskAttributes{Hash: "first", Name: "First"})
+	_ = memStore.Add(ctx, TaskAttributes{Hash: "second", Name: "Second"})
+	if err := memStore.Add(ctx, TaskAttributes{Hash: "first", Name: "Changed"}); !errors.Is(err, ErrConflict) {
+		t.Error("Adding a task with an existing hash should conflict, got: ", err)
+	}
+
+	tasks, err := memStore.Fetch(ctx)
+	if err != nil || len(tasks) != 2 {
+		t.Fatal("Adding a task with an existing hash should not store it")
+	}
+	if tasks[0].Name != "First" || tasks[1].Name != "Second" {
+		t.Error("Tasks should be fetched in the order they were added")
+	}
+}
+
+func TestMemoryStorageUpdate(t *testing.T) {
+	ctx := context.Background()
+	memStore := NewMemoryStorage()
+	_ = memStore.Add(ctx, TaskAttributes{Hash: "hash", Name: "Task", NextRun: "before", Duration: "5s"})
+	_ = memStore.Update(ctx, TaskAttributes{Hash: "hash", Name: "Other", NextRun: "after", LastRun: "before", Duration: "1s"})
+	if err := memStore.Update(ctx, TaskAttributes{Hash: "unknown", NextRun: "after"}); !errors.Is(err, ErrNotFound) {
+		t.Error("Updating an unknown task should not find it, got: ", err)
+	}
+
+	task, ok := memStore.Get("hash")
+	if !ok || task.NextRun != "after" || task.LastRun != "before" {
+		t.Error("Updating a task should store its run times")
+	}
+	if task.Name != "Task" || task.Duration != "5s" {
+		t.Error("Updating a task should leave its other attributes untouched")
+	}
+	if _, ok := memStore.Get("unknown"); ok || memStore.Len() != 1 {
+		t.Error("Updating an unknown task should not add it")
+	}
+}
+
+func TestMemoryStorageRemove(t *testing.T) {
+	ctx := context.Background()
+	memStore := NewMemoryStorage()
+	_ = memStore.Add(ctx, TaskAttributes{Hash: "first"})
+	_ = memStore.Add(ctx, TaskAttributes{Hash: "second"})
+
+	if err := memStore.Remove(ctx, TaskAttributes{Hash: "first"}); err != nil {
+		t.Error("Removing a task should not fail: ", err)
+	}
+	if err := memStore.Remove(ctx, TaskAttributes{Hash: "unknown"}); !errors.Is(err, ErrNotFound) {
+		t.Error("Removing an unknown task should not find it, got: ", err)
+	}
+	snapshot := memStore.Snapshot()
+	if len(snapshot) != 1 || snapshot[0].Hash != "second" {
+		t.Error("Only the removed task should be gone")
+	}
+}
+
+func TestMemoryStorageSnapshotIsACopy(t *testing.T) {
+	ctx := context.Background()
+	memStore := NewMemoryStorage()
+	_ = memStore.Add(ctx, TaskAttributes{Hash: "hash", Name: "Task"})
+	snapshot := memStore.Snapshot()
+	snapshot[0].Name = "Changed"
+
+	if task, _ := memStore.Get("hash"); task.Name != "Task" {
+		t.Error("Changing a snapshot should not change the store")
+	}
+}
+
+func TestMemoryStorageConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	memStore := NewMemoryStorage()
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				task := TaskAttributes{Hash: string(rune('a' + j%10))}
+				_ = memStore.Add(ctx, task)
+				_ = memStore.Update(ctx, task)
+				_, _ = memStore.Fetch(ctx)
+				_ = memStore.Remove(ctx, task)
+			}
+		}(i)
+	}
+	wg.Wait()
+}
+
+func TestMemoryStorageLease(t *testing.T) {
+	ctx := context.Background()
+	memStore := NewMemoryStorage()
+	_ = memStore.Add(ctx, TaskAttributes{Hash: "due", NextRun: "2017-11-10T12:00:00Z"})
+	_ = memStore.Add(ctx, TaskAttributes{Hash: "later", NextRun: "2017-11-10T13:00:00Z"})
+	now, _ := time.Parse(time.RFC3339, "2017-11-10T12:00:00Z")
+
+	if err := memStore.Lease(ctx, "due", "first", now, now.Add(time.Minute)); err != nil {
+		t.Fatal("Leasing a due task should succeed: ", err)
+	}
+	if err := memStore.Lease(ctx, "due", "second", now, now.Add(time.Minute)); !errors.Is(err, ErrNotLeased) {
+		t.Error("Leasing a task leased by another owner should fail, got: ", err)
+	}
+	if err := memStore.Lease(ctx, "later", "second", now, now.Add(time.Minute)); !errors.Is(err, ErrNotLeased) {
+		t.Error("Leasing a task which isn't due should fail, got: ", err)
+	}
+	if err := memStore.RenewLease(ctx, "due", "second", now.Add(time.Minute)); !errors.Is(err, ErrNotLeased) {
+		t.Error("Renewing a lease held by another owner should fail, got: ", err)
+	}
+	if err := memStore.RenewLease(ctx, "due", "first", now.Add(2*time.Minute)); err != nil {
+		t.Error("Renewing a held lease should succeed: ", err)
+	}
+	if err := memStore.Lease(ctx, "due", "second", now.Add(3*time.Minute), now.Add(4*time.Minute)); err != nil {
+		t.Error("Leasing a task whose lease expired should succeed: ", err)
+	}
+
+	_ = memStore.ReleaseLease(ctx, "due", "first")
+	if err := memStore.Lease(ctx, "due", "first", now, now.Add(time.Minute)); !errors.Is(err, ErrNotLeased) {
+		t.Error("Releasing a lease which was taken over should not end it")
+	}
+	_ = memStore.ReleaseLease(ctx, "due", "second")
+	if err := memStore.Lease(ctx, "due", "first", now, now.Add(time.Minute)); err != nil {
+		t.Error("Leasing a released task should succeed: ", err)
+	}
+}
+
+func TestMemoryStorageCancelledContext(t *testing.T) {
+	memStore := NewMemoryStorage()
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	if err := memStore.Add(ctx, TaskAttributes{Hash: "hash"}); !errors.Is(err, context.Canceled) {
+		t.Error("Adding a task with a cancelled context should fail, got: ", err)
+	}
+	if memStore.Len() != 0 {
+		t.Error("A cancelled Add should not store the task")
+	}
+}
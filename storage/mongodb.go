@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/mongo"
+	"github.com/mongodb/mongo-go-driver/mongo/options"
+	"github.com/mongodb/mongo-go-driver/x/bsonx"
+)
+
+// duplicateKeyCode is the MongoDB error code for violations of a unique index.
+const duplicateKeyCode = 11000
+
+type MongoDBConfig struct {
+	DbURL      string
+	Database   string
+	Collection string // defaults to `scheduled_tasks`
+}
+
+type mongoDBStorage struct {
+	config     MongoDBConfig
+	client     *mongo.Client
+	collection *mongo.Collection
+}
+
+// NewMongoDBStorage connects to the given MongoDB and creates the unique index on
+// `hash` if it doesn't exist yet.
+func NewMongoDBStorage(config MongoDBConfig) (mongoStore *mongoDBStorage, err error) {
+	if config.Collection == "" {
+		config.Collection = "scheduled_tasks"
+	}
+	mongoStore = &mongoDBStorage{config: config}
+	err = mongoStore.connect()
+	if err != nil {
+		log.Printf("Unable to connect to DB : %s, error : %v", config.DbURL, err)
+		return nil, err
+	}
+	err = mongoStore.initialize()
+	if err != nil {
+		log.Printf("Couldn't initialize the DB, error : %v", err)
+		mongoStore.Close()
+		return nil, err
+	}
+	return mongoStore, nil
+}
+
+func (mongoStore *mongoDBStorage) connect() (err error) {
+	client, err := mongo.NewClient(mongoStore.config.DbURL)
+	if err != nil {
+		return err
+	}
+	if err = client.Connect(context.Background()); err != nil {
+		return err
+	}
+	mongoStore.client = client
+	mongoStore.collection = client.Database(mongoStore.config.Database).Collection(mongoStore.config.Collection)
+	return nil
+}
+
+func (mongoStore *mongoDBStorage) initialize() (err error) {
+	_, err = mongoStore.collection.Indexes().CreateOne(context.Background(), mongo.IndexModel{
+		Keys:    bsonx.Doc{{Key: "hash", Value: bsonx.Int32(1)}},
+		Options: bsonx.Doc{{Key: "unique", Value: bsonx.Boolean(true)}},
+	})
+	if err != nil {
+		return fmt.Errorf("Error while creating the hash index: %s", err)
+	}
+	return nil
+}
+
+func (mongoStore *mongoDBStorage) Close() error {
+	return mongoStore.client.Disconnect(context.Background())
+}
+
+// Add inserts the task unless a task with the same hash is already stored.
+func (mongoStore *mongoDBStorage) Add(ctx context.Context, task TaskAttributes) error {
+	document, err := newTypedTask(task)
+	if err != nil {
+		return err
+	}
+	result, err := mongoStore.upsert(ctx, task.Hash, bson.D{{Key: "$setOnInsert", Value: document}})
+	if err != nil {
+		return fmt.Errorf("Error while inserting task: %w", err)
+	}
+	if result.MatchedCount > 0 {
+		return fmt.Errorf("%w: %s", ErrConflict, task.Hash)
+	}
+	return nil
+}
+
+// Update stores the run times and retry state of the task. A task which isn't
+// stored yet is inserted with all of its attributes, so ErrNotFound is never returned.
+func (mongoStore *mongoDBStorage) Update(ctx context.Context, task TaskAttributes) error {
+	document, err := newTypedTask(task)
+	if err != nil {
+		return err
+	}
+	_, err = mongoStore.upsert(ctx, task.Hash, bson.D{
+		{Key: "$set", Value: bson.D{
+			{Key: "last_run", Value: document.LastRun},
+			{Key: "next_run", Value: document.NextRun},
+			{Key: "attempt", Value: document.Attempt},
+			{Key: "retry_at", Value: document.RetryAt},
+		}},
+		{Key: "$setOnInsert", Value: bson.D{
+			{Key: "name", Value: document.Name},
+			{Key: "params", Value: document.Params},
+			{Key: "duration", Value: document.Duration},
+			{Key: "is_recurring", Value: document.IsRecurring},
+			{Key: "cron_expr", Value: document.CronExpr},
+			{Key: "location", Value: document.Location},
+			{Key: "timeout", Value: document.Timeout},
+			{Key: "retry_policy", Value: document.RetryPolicy},
+			{Key: "misfire_policy", Value: document.MisfirePolicy},
+			{Key: "overlap_policy", Value: document.OverlapPolicy},
+			{Key: "first_run", Value: document.FirstRun},
+		}},
+	})
+	if err != nil {
+		return fmt.Errorf("Error while updating task: %w", err)
+	}
+	return nil
+}
+
+func (mongoStore *mongoDBStorage) Fetch(ctx context.Context) ([]TaskAttributes, error) {
+	cursor, err := mongoStore.collection.Find(ctx, bson.D{})
+	if err != nil {
+		return nil, fmt.Errorf("Error while fetching tasks: %w", err)
+	}
+	defer cursor.Close(ctx)
+
+	var tasks []TaskAttributes
+	for cursor.Next(ctx) {
+		var document typedTask
+		if err := cursor.Decode(&document); err != nil {
+			return nil, fmt.Errorf("Error while reading task: %w", err)
+		}
+		tasks = append(tasks, document.attributes())
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, fmt.Errorf("Error while fetching tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+func (mongoStore *mongoDBStorage) Remove(ctx context.Context, task TaskAttributes) error {
+	result, err := mongoStore.collection.DeleteOne(ctx, bson.D{{Key: "hash", Value: task.Hash}})
+	if err != nil {
+		return fmt.Errorf("Error while deleting task: %w", err)
+	}
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("%w: %s", ErrNotFound, task.Hash)
+	}
+	return nil
+}
+
+// upsert applies the update to the task with the given hash, inserting it if needed.
+// Two concurrent upserts of the same hash can both attempt the insert, the one
+// rejected by the unique index is retried once and then matches the stored task.
+func (mongoStore *mongoDBStorage) upsert(ctx context.Context, hash string,
+	update bson.D) (result *mongo.UpdateResult, err error) {
+	filter := bson.D{{Key: "hash", Value: hash}}
+	for i := 0; i < 2; i++ {
+		result, err = mongoStore.collection.UpdateOne(ctx, filter, update, options.Update().SetUpsert(true))
+		if !isDuplicateKey(err) {
+			return result, err
+		}
+	}
+	return result, err
+}
+
+func isDuplicateKey(err error) bool {
+	var writeErrors mongo.WriteErrors
+	if !errors.As(err, &writeErrors) {
+		return false
+	}
+	for _, writeError := range writeErrors {
+		if writeError.Code == duplicateKeyCode {
+			return true
+		}
+	}
+	return false
+}
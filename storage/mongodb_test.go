@@ -0,0 +1,200 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/mongodb/mongo-go-driver/bson"
+	"github.com/mongodb/mongo-go-driver/bson/bsontype"
+)
+
+var mongoTestAttributes = TaskAttributes{
+	Hash:          "first",
+	Name:          "First",
+	LastRun:       "2017-11-10T12:00:00Z",
+	NextRun:       "2017-11-10T12:00:05Z",
+	Duration:      "5s",
+	IsRecurring:   "1",
+	CronExpr:      "*/5 * * * *",
+	Location:      "Europe/Berlin",
+	Timeout:       "1m0s",
+	RetryPolicy:   `{"MaxAttempts":3}`,
+	Attempt:       "1",
+	RetryAt:       "2017-11-10T12:00:01Z",
+	Params:        `["Hello"]`,
+	MisfirePolicy: `{"Mode":2,"GraceTime":0}`,
+	OverlapPolicy: "1",
+	FirstRun:      "2017-11-10T12:00:00Z",
+}
+
+func TestMongoTaskBSONTypes(t *testing.T) {
+	document, err := newTypedTask(mongoTestAttributes)
+	if err != nil {
+		t.Fatal("Converting the attributes should not fail: ", err)
+	}
+	encoded, err := bson.Marshal(document)
+	if err != nil {
+		t.Fatal("Encoding the document should not fail: ", err)
+	}
+
+	expectedTypes := map[string]bsontype.Type{
+		"last_run":     bsontype.DateTime,
+		"next_run":     bsontype.DateTime,
+		"retry_at":     bsontype.DateTime,
+		"first_run":    bsontype.DateTime,
+		"duration":     bsontype.Int64,
+		"timeout":      bsontype.Int64,
+		"attempt":      bsontype.Int64,
+		"is_recurring": bsontype.Boolean,
+	}
+	for key, expected := range expectedTypes {
+		if actual := bson.Raw(encoded).Lookup(key).Type; actual != expected {
+			t.Errorf("%s should be stored as %s, found %s", key, expected, actual)
+		}
+	}
+
+	var decoded typedTask
+	if err := bson.Unmarshal(encoded, &decoded); err != nil {
+		t.Fatal("Decoding the document should not fail: ", err)
+	}
+	if attributes := decoded.attributes(); attributes != mongoTestAttributes {
+		t.Errorf("The attributes should survive a round trip, found %+v", attributes)
+	}
+}
+
+func TestMongoTaskEmptyAttributes(t *testing.T) {
+	document, err := newTypedTask(TaskAttributes{Hash: "hash", Duration: "5s", IsRecurring: "0"})
+	if err != nil {
+		t.Fatal("Empty attributes should be stored as zero values: ", err)
+	}
+	encoded, _ := bson.Marshal(document)
+	if bson.Raw(encoded).Lookup("retry_at").Type != bsontype.Null {
+		t.Error("A task without a retry should store a null retry_at")
+	}
+
+	var decoded typedTask
+	_ = bson.Unmarshal(encoded, &decoded)
+	if attributes := decoded.attributes(); attributes.RetryAt != "" || attributes.Attempt != "0" {
+		t.Errorf("An empty retry state should survive a round trip, found %+v", attributes)
+	}
+}
+
+// newTestMongoDBStorage connects to the MongoDB at MONGODB_URL, e.g. a local mongod at
+// mongodb://localhost:27017, and skips the test if it isn't set. Every test uses its own
+// collection.
+func newTestMongoDBStorage(t *testing.T) *mongoDBStorage {
+	dbURL := os.Getenv("MONGODB_URL")
+	if dbURL == "" {
+		t.Skip("MONGODB_URL is not set")
+	}
+
+	mongoStore, err := NewMongoDBStorage(MongoDBConfig{
+		DbURL:      dbURL,
+		Database:   "scheduler_test",
+		Collection: fmt.Sprintf("%s_%d", t.Name(), time.Now().UnixNano()),
+	})
+	if err != nil {
+		t.Fatal("Failed to connect to MongoDB: ", err)
+	}
+	t.Cleanup(func() {
+		mongoStore.collection.Drop(context.Background())
+		mongoStore.Close()
+	})
+	return mongoStore
+}
+
+func TestMongoDBStorageAdd(t *testing.T) {
+	ctx := context.Background()
+	mongoStore := newTestMongoDBStorage(t)
+	_ = mongoStore.Add(ctx, mongoTestAttributes)
+	_ = mongoStore.Add(ctx, TaskAttributes{Hash: "second", Name: "Second"})
+	if err := mongoStore.Add(ctx, TaskAttributes{Hash: "first", Name: "Changed"}); !errors.Is(err, ErrConflict) {
+		t.Error("Adding a task with an existing hash should conflict, got: ", err)
+	}
+
+	tasks, err := mongoStore.Fetch(ctx)
+	if err != nil || len(tasks) != 2 {
+		t.Fatal("Adding a task with an existing hash should not store it")
+	}
+	for _, task := range tasks {
+		if task.Hash == "first" && task != mongoTestAttributes {
+			t.Errorf("All attributes should be stored, found %+v", task)
+		}
+	}
+}
+
+func TestMongoDBStorageUpdate(t *testing.T) {
+	ctx := context.Background()
+	mongoStore := newTestMongoDBStorage(t)
+	_ = mongoStore.Add(ctx, TaskAttributes{Hash: "hash", Name: "Task", NextRun: "2017-11-10T12:00:00Z", Duration: "5s"})
+	_ = mongoStore.Update(ctx, TaskAttributes{Hash: "hash", Name: "Other", NextRun: "2017-11-10T12:00:05Z",
+		LastRun: "2017-11-10T12:00:00Z", Duration: "1s", Attempt: "2", RetryAt: "2017-11-10T12:00:01Z"})
+	_ = mongoStore.Update(ctx, TaskAttributes{Hash: "unknown", Name: "Unknown", NextRun: "2017-11-10T12:00:05Z"})
+
+	tasks, err := mongoStore.Fetch(ctx)
+	if err != nil || len(tasks) != 2 {
+		t.Fatal("Updating an unknown task should insert it")
+	}
+	for _, task := range tasks {
+		switch task.Hash {
+		case "hash":
+			if task.NextRun != "2017-11-10T12:00:05Z" || task.LastRun != "2017-11-10T12:00:00Z" ||
+				task.Attempt != "2" || task.RetryAt != "2017-11-10T12:00:01Z" {
+				t.Error("Updating a task should store its run times and retry state")
+			}
+			if task.Name != "Task" || task.Duration != "5s" {
+				t.Error("Updating a task should leave its other attributes untouched")
+			}
+		case "unknown":
+			if task.Name != "Unknown" {
+				t.Error("An upserted task should be stored with all of its attributes")
+			}
+		}
+	}
+}
+
+func TestMongoDBStorageRemove(t *testing.T) {
+	ctx := context.Background()
+	mongoStore := newTestMongoDBStorage(t)
+	_ = mongoStore.Add(ctx, TaskAttributes{Hash: "first"})
+	_ = mongoStore.Add(ctx, TaskAttributes{Hash: "second"})
+
+	if err := mongoStore.Remove(ctx, TaskAttributes{Hash: "first"}); err != nil {
+		t.Error("Removing a task should not fail: ", err)
+	}
+	if err := mongoStore.Remove(ctx, TaskAttributes{Hash: "unknown"}); !errors.Is(err, ErrNotFound) {
+		t.Error("Removing an unknown task should not find it, got: ", err)
+	}
+	tasks, _ := mongoStore.Fetch(ctx)
+	if len(tasks) != 1 || tasks[0].Hash != "second" {
+		t.Error("Only the removed task should be gone")
+	}
+}
+
+func TestMongoDBStorageConcurrentAdd(t *testing.T) {
+	ctx := context.Background()
+	mongoStore := newTestMongoDBStorage(t)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				err := mongoStore.Add(ctx, TaskAttributes{Hash: string(rune('a' + j%10))})
+				if err != nil && !errors.Is(err, ErrConflict) {
+					t.Error("Adding a task concurrently should not fail: ", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if tasks, _ := mongoStore.Fetch(ctx); len(tasks) != 10 {
+		t.Errorf("Every hash should be stored once, found %d tasks", len(tasks))
+	}
+}
@@ -1,10 +1,12 @@
 package storage
 
 import (
+	"context"
 	"database/sql"
-	"encoding/json"
 	"fmt"
 	"log"
+	"sync"
+	"time"
 
 	_ "github.com/lib/pq"
 )
@@ -16,8 +18,15 @@ type PostgresDBConfig struct {
 type postgresStorage struct {
 	config PostgresDBConfig
 	db     *sql.DB
+
+	// leaderConn is the connection holding the leader lock while leading.
+	leaderMu   sync.Mutex
+	leaderConn *sql.Conn
 }
 
+// postgresLeaderLock is the key of the advisory lock held by the leader.
+const postgresLeaderLock = 7_361_095_302
+
 // creates new instance of postgres DB
 func NewPostgresStorage(config PostgresDBConfig) (postgres *postgresStorage, err error) {
 	// TODO should connect and initialize as well.
@@ -47,169 +56,258 @@ func (postgres *postgresStorage) connect() (err error) {
 	return nil
 }
 
-func (postgres *postgresStorage) initialize() (err error) {
-	stmt := `
-	CREATE TABLE IF NOT EXISTS scheduled_tasks (
-		id SERIAL NOT NULL PRIMARY KEY,
-		name text,
-		params text,
-		duration text,
-		last_run text,
-		next_run text,
-		is_recurring text,
-		hash text
-	);
-	`
-	_, err = postgres.db.Exec(stmt)
+// initialize migrates the schema to the latest version, see postgresMigrations.
+func (postgres *postgresStorage) initialize() error {
+	err := postgres.migrate(context.Background())
 	if err != nil {
-		log.Printf("Error while initializing: %q - %+v", stmt, err)
-		return
+		log.Printf("Error while initializing: %+v", err)
 	}
-	return
+	return err
 }
 
 func (postgres *postgresStorage) Close() error {
+	_ = postgres.Resign(context.Background())
 	return postgres.db.Close()
 }
 
-func (postgres *postgresStorage) Add(task TaskAttributes) error {
-	// should add a task to the database `scheduled_tasks` table
-	var count int
-	rows, err := postgres.db.Query("SELECT count(*) FROM scheduled_tasks WHERE hash=($1) ;", task.Hash)
-	defer rows.Close()
-	if err == nil {
-		rows.Next()
-		_ = rows.Scan(&count)
+// TryLead takes the leader's advisory lock on a dedicated connection, as the lock is
+// held until the session which took it ends. The leader's connection is checked on
+// every call, so that a leader which lost it, and thereby the lock, stops leading.
+func (postgres *postgresStorage) TryLead(ctx context.Context) (bool, error) {
+	postgres.leaderMu.Lock()
+	defer postgres.leaderMu.Unlock()
+
+	if postgres.leaderConn != nil {
+		if _, err := postgres.leaderConn.ExecContext(ctx, `SELECT 1;`); err == nil {
+			return true, nil
+		}
+		postgres.leaderConn.Close()
+		postgres.leaderConn = nil
 	}
 
-	if count == 0 {
-		return postgres.insert(task)
+	conn, err := postgres.db.Conn(ctx)
+	if err != nil {
+		return false, fmt.Errorf("Error while connecting: %w", err)
 	}
-	return nil
+	var locked bool
+	err = conn.QueryRowContext(ctx, `SELECT pg_try_advisory_lock($1);`, postgresLeaderLock).Scan(&locked)
+	if err != nil || !locked {
+		conn.Close()
+		if err != nil {
+			return false, fmt.Errorf("Error while taking the leader lock: %w", err)
+		}
+		return false, nil
+	}
+	postgres.leaderConn = conn
+	return true, nil
 }
 
-func (postgres *postgresStorage) Update(task TaskAttributes) error {
-	// should update a task in the database `scheduled_tasks` table
-	var count int
-	rows, err := postgres.db.Query("SELECT count(*) FROM scheduled_tasks WHERE hash=($1) ;", task.Hash)
-	defer rows.Close()
-	if err == nil {
-		rows.Next()
-		_ = rows.Scan(&count)
-	}
+// Resign releases the leader lock and the connection holding it.
+func (postgres *postgresStorage) Resign(ctx context.Context) error {
+	postgres.leaderMu.Lock()
+	defer postgres.leaderMu.Unlock()
 
-	if count == 0 {
+	if postgres.leaderConn == nil {
 		return nil
 	}
+	_, err := postgres.leaderConn.ExecContext(ctx, `SELECT pg_advisory_unlock($1);`, postgresLeaderLock)
+	postgres.leaderConn.Close()
+	postgres.leaderConn = nil
+	if err != nil {
+		return fmt.Errorf("Error while releasing the leader lock: %w", err)
+	}
+	return nil
+}
+
+// Add inserts the task, the unique index on hash prevents concurrent adds of the
+// same task from both inserting it.
+func (postgres *postgresStorage) Add(ctx context.Context, task TaskAttributes) error {
+	typed, err := newTypedTask(task)
+	if err != nil {
+		return fmt.Errorf("Error while converting task: %w", err)
+	}
+	result, err := postgres.db.ExecContext(ctx, `
+        INSERT INTO scheduled_tasks(name, params, duration, last_run, next_run, is_recurring, cron_expr, location, timeout,
+                                    retry_policy, attempt, retry_at, hash, misfire_policy, overlap_policy, first_run)
+        VALUES (($1), COALESCE(NULLIF(($2), ''), '[]')::jsonb, ($3), ($4), ($5), ($6), ($7), ($8), ($9), ($10)::jsonb, ($11), ($12), ($13),
+                ($14)::jsonb, ($15), ($16))
+        ON CONFLICT (hash) DO NOTHING;`,
+		typed.Name,
+		typed.Params,
+		int64(typed.Duration),
+		nullTime(typed.LastRun),
+		typed.NextRun,
+		typed.IsRecurring,
+		typed.CronExpr,
+		typed.Location,
+		int64(typed.Timeout),
+		nullString(typed.RetryPolicy),
+		typed.Attempt,
+		typed.RetryAt,
+		typed.Hash,
+		nullString(typed.MisfirePolicy),
+		typed.OverlapPolicy,
+		nullTime(typed.FirstRun),
+	)
+	if err != nil {
+		return fmt.Errorf("Error while inserting task: %w", err)
+	}
+	return expectRow(result, ErrConflict, task.Hash)
+}
 
-	return postgres.update(task)
+// Update stores the run times and retry state of the task.
+func (postgres *postgresStorage) Update(ctx context.Context, task TaskAttributes) error {
+	typed, err := newTypedTask(task)
+	if err != nil {
+		return fmt.Errorf("Error while converting task: %w", err)
+	}
+	result, err := postgres.db.ExecContext(ctx, `
+        UPDATE scheduled_tasks SET last_run = ($1), next_run = ($2), attempt = ($3), retry_at = ($4)
+        WHERE hash = ($5);`,
+		nullTime(typed.LastRun),
+		typed.NextRun,
+		typed.Attempt,
+		typed.RetryAt,
+		typed.Hash,
+	)
+	if err != nil {
+		return fmt.Errorf("Error while updating task: %w", err)
+	}
+	return expectRow(result, ErrNotFound, task.Hash)
 }
 
-func (postgres *postgresStorage) Fetch() ([]TaskAttributes, error) {
+// postgresTaskColumns are the columns scanned by scanTasks.
+const postgresTaskColumns = `hash, name, params::text, duration, last_run, next_run, is_recurring, cron_expr,
+               location, timeout, retry_policy::text, attempt, retry_at, misfire_policy::text,
+               overlap_policy, first_run`
+
+func (postgres *postgresStorage) Fetch(ctx context.Context) ([]TaskAttributes, error) {
 	// read all the rows scheduled_tasks table.
-	rows, err := postgres.db.Query(`
-        SELECT name, params, duration, last_run, next_run, is_recurring
-        FROM scheduled_tasks ;`)
+	rows, err := postgres.db.QueryContext(ctx, `
+        SELECT `+postgresTaskColumns+`
+        FROM scheduled_tasks ORDER BY id;`)
+	if err != nil {
+		return nil, fmt.Errorf("Error while fetching tasks: %w", err)
+	}
+	return scanTasks(rows)
+}
 
+// FetchDue queries the indexes on next_run and retry_at, so that only the due tasks
+// are read.
+func (postgres *postgresStorage) FetchDue(ctx context.Context, before time.Time, limit int) ([]TaskAttributes, error) {
+	rows, err := postgres.db.QueryContext(ctx, `
+        SELECT `+postgresTaskColumns+`
+        FROM scheduled_tasks WHERE next_run < ($1) OR retry_at < ($1)
+        ORDER BY LEAST(next_run, retry_at), id LIMIT ($2);`,
+		before, limit)
 	if err != nil {
-		log.Fatal(err)
+		return nil, fmt.Errorf("Error while fetching due tasks: %w", err)
 	}
+	return scanTasks(rows)
+}
 
+func (postgres *postgresStorage) FetchByHash(ctx context.Context, hash string) (TaskAttributes, error) {
+	rows, err := postgres.db.QueryContext(ctx, `
+        SELECT `+postgresTaskColumns+`
+        FROM scheduled_tasks WHERE hash = ($1);`,
+		hash)
+	if err != nil {
+		return TaskAttributes{}, fmt.Errorf("Error while fetching task: %w", err)
+	}
+	tasks, err := scanTasks(rows)
+	if err != nil {
+		return TaskAttributes{}, err
+	}
+	if len(tasks) == 0 {
+		return TaskAttributes{}, fmt.Errorf("%w: %s", ErrNotFound, hash)
+	}
+	return tasks[0], nil
+}
+
+// scanTasks reads the postgresTaskColumns of every row and closes rows.
+func scanTasks(rows *sql.Rows) ([]TaskAttributes, error) {
 	defer rows.Close()
 
 	var tasks []TaskAttributes
-
 	for rows.Next() {
-		// var task TaskAttributes
-		task := TaskAttributes{}
-
-		var arrStr string
-		var arr []string
-		err := rows.Scan(&task.Name, &arrStr, &task.Duration, &task.LastRun, &task.NextRun, &task.IsRecurring)
+		var (
+			task                       typedTask
+			lastRun, retryAt, firstRun sql.NullTime
+			retryPolicy                sql.NullString
+			misfirePolicy              sql.NullString
+			duration, timeout          int64
+		)
+		err := rows.Scan(&task.Hash, &task.Name, &task.Params, &duration, &lastRun, &task.NextRun,
+			&task.IsRecurring, &task.CronExpr, &task.Location, &timeout, &retryPolicy, &task.Attempt,
+			&retryAt, &misfirePolicy, &task.OverlapPolicy, &firstRun)
 		if err != nil {
-			return []TaskAttributes{}, err
+			return nil, fmt.Errorf("Error while reading task: %w", err)
 		}
-
-		err = json.Unmarshal([]byte(arrStr), &arr)
-		if err != nil {
-			return []TaskAttributes{}, err
+		task.Duration = time.Duration(duration)
+		task.Timeout = time.Duration(timeout)
+		task.LastRun = lastRun.Time
+		task.FirstRun = firstRun.Time
+		task.RetryPolicy = retryPolicy.String
+		task.MisfirePolicy = misfirePolicy.String
+		if retryAt.Valid {
+			task.RetryAt = &retryAt.Time
 		}
-
-		task.Params = arr
-		tasks = append(tasks, task)
+		tasks = append(tasks, task.attributes())
 	}
-	err = rows.Err()
-	if err != nil {
-		log.Fatal(err)
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error while fetching tasks: %w", err)
 	}
 	return tasks, nil
 }
 
-func (postgres *postgresStorage) Remove(task TaskAttributes) error {
-	// should delete the entry from `task_stor` table.
-	stmt, err := postgres.db.Prepare(`DELETE FROM scheduled_tasks WHERE hash=($1) ;`)
-
+func (postgres *postgresStorage) Remove(ctx context.Context, task TaskAttributes) error {
+	result, err := postgres.db.ExecContext(ctx, `DELETE FROM scheduled_tasks WHERE hash=($1) ;`, task.Hash)
 	if err != nil {
-		return fmt.Errorf("Error while pareparing delete task statement: %s+v", err)
+		return fmt.Errorf("Error while deleting task: %w", err)
 	}
+	return expectRow(result, ErrNotFound, task.Hash)
+}
 
-	defer stmt.Close()
-
-	_, err = stmt.Exec(
-		task.Hash,
-	)
+// Lease claims the task with a single UPDATE. Its row lock makes concurrent leases of
+// the same task wait for each other, the ones which find it leased then don't match.
+func (postgres *postgresStorage) Lease(ctx context.Context, hash, owner string, now, until time.Time) error {
+	result, err := postgres.db.ExecContext(ctx, `
+        UPDATE scheduled_tasks SET locked_by = ($2), lease_until = ($4)
+        WHERE hash = ($1) AND (next_run <= ($3) OR retry_at <= ($3))
+          AND (locked_by IS NULL OR locked_by = ($2) OR lease_until < ($3));`,
+		hash, owner, now, until)
 	if err != nil {
-		return fmt.Errorf("Error while deleting task: %+v", err)
+		return fmt.Errorf("Error while leasing task: %w", err)
 	}
-
-	return nil
+	return expectRow(result, ErrNotLeased, hash)
 }
 
-func (postgres *postgresStorage) insert(task TaskAttributes) (err error) {
-	stmt, err := postgres.db.Prepare(`
-        INSERT INTO scheduled_tasks(name, params, duration, last_run, next_run, is_recurring, hash)
-        VALUES(($1), ($2), ($3), ($4), ($5), ($6), ($7));`)
-
+func (postgres *postgresStorage) RenewLease(ctx context.Context, hash, owner string, until time.Time) error {
+	result, err := postgres.db.ExecContext(ctx, `
+        UPDATE scheduled_tasks SET lease_until = ($3) WHERE hash = ($1) AND locked_by = ($2);`,
+		hash, owner, until)
 	if err != nil {
-		return fmt.Errorf("Error while pareparing insert task statement: %s", err)
+		return fmt.Errorf("Error while renewing lease: %w", err)
 	}
+	return expectRow(result, ErrNotLeased, hash)
+}
 
-	defer stmt.Close()
-
-	paramsJson, _ := json.Marshal(task.Params)
-	_, err = stmt.Exec(
-		task.Name,
-		paramsJson,
-		task.Duration,
-		task.LastRun,
-		task.NextRun,
-		task.IsRecurring,
-		task.Hash,
-	)
+func (postgres *postgresStorage) ReleaseLease(ctx context.Context, hash, owner string) error {
+	_, err := postgres.db.ExecContext(ctx, `
+        UPDATE scheduled_tasks SET locked_by = NULL, lease_until = NULL WHERE hash = ($1) AND locked_by = ($2);`,
+		hash, owner)
 	if err != nil {
-		return fmt.Errorf("Error while inserting task: %s", err)
+		return fmt.Errorf("Error while releasing lease: %w", err)
 	}
-
 	return nil
 }
 
-func (postgres *postgresStorage) update(task TaskAttributes) (err error) {
-	stmt, err := postgres.db.Prepare(`UPDATE scheduled_tasks SET last_run = ($1), next_run = ($2) WHERE hash = ($3);`)
-
-	if err != nil {
-		return fmt.Errorf("Error while pareparing update task statement: %s", err)
-	}
-
-	defer stmt.Close()
-
-	_, err = stmt.Exec(
-		task.LastRun,
-		task.NextRun,
-		task.Hash,
-	)
-	if err != nil {
-		return fmt.Errorf("Error while updating task: %s", err)
-	}
+// nullTime stores the zero time, a task which never ran, as NULL.
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
 
-	return nil
+// nullString stores an empty string as NULL.
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
 }
@@ -0,0 +1,79 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// AddExecution records a run of a task in scheduled_task_executions.
+func (postgres *postgresStorage) AddExecution(ctx context.Context, record ExecutionRecord) error {
+	_, err := postgres.db.ExecContext(ctx, `
+        INSERT INTO scheduled_task_executions(hash, name, params, scheduled_at, started_at, finished_at, attempt,
+                                              outcome, error)
+        VALUES (($1), ($2), COALESCE(NULLIF(($3), ''), '[]')::jsonb, ($4), ($5), ($6), ($7), ($8), ($9));`,
+		record.Hash,
+		record.Name,
+		record.Params,
+		record.ScheduledAt,
+		record.StartedAt,
+		record.FinishedAt,
+		record.Attempt,
+		string(record.Outcome),
+		record.Error,
+	)
+	if err != nil {
+		return fmt.Errorf("Error while inserting execution: %w", err)
+	}
+	return nil
+}
+
+// FetchExecutions queries the index on hash and started_at. Unset filters are passed
+// as NULL, which doesn't restrict the records.
+func (postgres *postgresStorage) FetchExecutions(ctx context.Context, hash string, filter HistoryFilter) ([]ExecutionRecord, error) {
+	rows, err := postgres.db.QueryContext(ctx, `
+        SELECT hash, name, params::text, scheduled_at, started_at, finished_at, attempt, outcome, error
+        FROM scheduled_task_executions
+        WHERE hash = ($1)
+          AND (($2)::timestamptz IS NULL OR started_at >= ($2))
+          AND (($3)::timestamptz IS NULL OR started_at < ($3))
+          AND (($4) = '' OR outcome = ($4))
+        ORDER BY started_at DESC, id DESC LIMIT ($5);`,
+		hash,
+		nullTime(filter.Since),
+		nullTime(filter.Until),
+		string(filter.Outcome),
+		sql.NullInt64{Int64: int64(filter.Limit), Valid: filter.Limit > 0},
+	)
+	if err != nil {
+		return nil, fmt.Errorf("Error while fetching executions: %w", err)
+	}
+	defer rows.Close()
+
+	var records []ExecutionRecord
+	for rows.Next() {
+		var record ExecutionRecord
+		err := rows.Scan(&record.Hash, &record.Name, &record.Params, &record.ScheduledAt, &record.StartedAt,
+			&record.FinishedAt, &record.Attempt, &record.Outcome, &record.Error)
+		if err != nil {
+			return nil, fmt.Errorf("Error while reading execution: %w", err)
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error while fetching executions: %w", err)
+	}
+	return records, nil
+}
+
+// PruneExecutions removes the records of runs which finished before the given time.
+func (postgres *postgresStorage) PruneExecutions(ctx context.Context, before time.Time) (int, error) {
+	result, err := postgres.db.ExecContext(ctx, `DELETE FROM scheduled_task_executions WHERE finished_at < ($1);`,
+		before)
+	if err != nil {
+		return 0, fmt.Errorf("Error while pruning executions: %w", err)
+	}
+	pruned, err := result.RowsAffected()
+	return int(pruned), err
+}
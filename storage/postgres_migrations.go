@@ -0,0 +1,247 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+	"log"
+)
+
+// postgresMigrationLock is the key of the advisory lock which serializes schedulers
+// migrating the same database.
+const postgresMigrationLock = 7_361_095_301
+
+// postgresMigration upgrades the schema to its version. Migrations are applied in
+// order, each in its own transaction, and recorded in `scheduled_tasks_migrations`.
+type postgresMigration struct {
+	version     int
+	description string
+	stmt        string
+}
+
+var postgresMigrations = []postgresMigration{
+	{
+		version:     1,
+		description: "Create the text-typed scheduled_tasks table",
+		// The table created by earlier releases, which didn't record migrations. Existing
+		// tables get the columns added since then.
+		stmt: `
+	CREATE TABLE IF NOT EXISTS scheduled_tasks (
+		id SERIAL NOT NULL PRIMARY KEY,
+		name text,
+		params text,
+		duration text,
+		last_run text,
+		next_run text,
+		is_recurring text,
+		hash text
+	);
+	ALTER TABLE scheduled_tasks ADD COLUMN IF NOT EXISTS cron_expr text NOT NULL DEFAULT '';
+	ALTER TABLE scheduled_tasks ADD COLUMN IF NOT EXISTS location text NOT NULL DEFAULT '';
+	ALTER TABLE scheduled_tasks ADD COLUMN IF NOT EXISTS timeout text NOT NULL DEFAULT '';
+	ALTER TABLE scheduled_tasks ADD COLUMN IF NOT EXISTS retry_policy text NOT NULL DEFAULT '';
+	ALTER TABLE scheduled_tasks ADD COLUMN IF NOT EXISTS attempt text NOT NULL DEFAULT '0';
+	ALTER TABLE scheduled_tasks ADD COLUMN IF NOT EXISTS retry_at text NOT NULL DEFAULT '';
+	`,
+	},
+	{
+		version:     2,
+		description: "Convert scheduled_tasks to typed columns and index hash and next_run",
+		// Durations are converted from Go's duration format to nanoseconds, a last_run
+		// at the zero time means the task never ran and becomes NULL. Duplicated
+		// hashes, which the unique index doesn't allow, keep their oldest row.
+		stmt: `
+	DELETE FROM scheduled_tasks WHERE hash IS NULL;
+	DELETE FROM scheduled_tasks duplicate USING scheduled_tasks original
+	WHERE duplicate.hash = original.hash AND duplicate.id > original.id;
+
+	ALTER TABLE scheduled_tasks
+		ALTER COLUMN retry_policy DROP DEFAULT,
+		ALTER COLUMN retry_policy DROP NOT NULL,
+		ALTER COLUMN attempt DROP DEFAULT,
+		ALTER COLUMN retry_at DROP DEFAULT,
+		ALTER COLUMN retry_at DROP NOT NULL,
+		ADD COLUMN duration_ns bigint,
+		ADD COLUMN timeout_ns bigint;
+
+	UPDATE scheduled_tasks SET
+		duration_ns = (
+			SELECT COALESCE(SUM(parts[1]::numeric * CASE parts[2]
+				WHEN 'h' THEN 3600000000000 WHEN 'm' THEN 60000000000 WHEN 's' THEN 1000000000
+				WHEN 'ms' THEN 1000000 WHEN 'us' THEN 1000 WHEN 'µs' THEN 1000 ELSE 1 END), 0)
+				* CASE WHEN duration LIKE '-%' THEN -1 ELSE 1 END
+			FROM regexp_matches(COALESCE(duration, ''), '([0-9.]+)(ns|us|µs|ms|h|m|s)', 'g') AS match(parts)
+		),
+		timeout_ns = (
+			SELECT COALESCE(SUM(parts[1]::numeric * CASE parts[2]
+				WHEN 'h' THEN 3600000000000 WHEN 'm' THEN 60000000000 WHEN 's' THEN 1000000000
+				WHEN 'ms' THEN 1000000 WHEN 'us' THEN 1000 WHEN 'µs' THEN 1000 ELSE 1 END), 0)
+				* CASE WHEN timeout LIKE '-%' THEN -1 ELSE 1 END
+			FROM regexp_matches(COALESCE(timeout, ''), '([0-9.]+)(ns|us|µs|ms|h|m|s)', 'g') AS match(parts)
+		);
+
+	ALTER TABLE scheduled_tasks DROP COLUMN duration, DROP COLUMN timeout;
+	ALTER TABLE scheduled_tasks RENAME COLUMN duration_ns TO duration;
+	ALTER TABLE scheduled_tasks RENAME COLUMN timeout_ns TO timeout;
+
+	ALTER TABLE scheduled_tasks
+		ALTER COLUMN hash SET NOT NULL,
+		ALTER COLUMN name SET DEFAULT '',
+		ALTER COLUMN duration SET DEFAULT 0,
+		ALTER COLUMN duration SET NOT NULL,
+		ALTER COLUMN timeout SET DEFAULT 0,
+		ALTER COLUMN timeout SET NOT NULL,
+		ALTER COLUMN params TYPE jsonb USING COALESCE(NULLIF(params, ''), '[]')::jsonb,
+		ALTER COLUMN params SET DEFAULT '[]',
+		ALTER COLUMN params SET NOT NULL,
+		ALTER COLUMN last_run TYPE timestamptz
+			USING NULLIF(NULLIF(last_run, ''), '0001-01-01T00:00:00Z')::timestamptz,
+		ALTER COLUMN next_run TYPE timestamptz
+			USING COALESCE(NULLIF(next_run, ''), '0001-01-01T00:00:00Z')::timestamptz,
+		ALTER COLUMN next_run SET NOT NULL,
+		ALTER COLUMN is_recurring TYPE boolean USING COALESCE(is_recurring = '1', false),
+		ALTER COLUMN is_recurring SET DEFAULT false,
+		ALTER COLUMN is_recurring SET NOT NULL,
+		ALTER COLUMN retry_policy TYPE jsonb USING NULLIF(retry_policy, '')::jsonb,
+		ALTER COLUMN attempt TYPE integer USING COALESCE(NULLIF(attempt, ''), '0')::integer,
+		ALTER COLUMN attempt SET DEFAULT 0,
+		ALTER COLUMN retry_at TYPE timestamptz USING NULLIF(retry_at, '')::timestamptz;
+
+	CREATE UNIQUE INDEX scheduled_tasks_hash_key ON scheduled_tasks (hash);
+	CREATE INDEX scheduled_tasks_next_run_idx ON scheduled_tasks (next_run);
+	`,
+	},
+	{
+		version:     3,
+		description: "Index retry_at of scheduled_tasks",
+		// Only tasks waiting for a retry have a retry_at.
+		stmt: `
+	CREATE INDEX scheduled_tasks_retry_at_idx ON scheduled_tasks (retry_at) WHERE retry_at IS NOT NULL;
+	`,
+	},
+	{
+		version:     4,
+		description: "Add the lease of scheduled_tasks",
+		stmt: `
+	ALTER TABLE scheduled_tasks ADD COLUMN locked_by text, ADD COLUMN lease_until timestamptz;
+	`,
+	},
+	{
+		version:     5,
+		description: "Notify about changes of scheduled_tasks",
+		// Changes of leases aren't relevant to other schedulers, so only updates of
+		// the schedule notify.
+		stmt: `
+	CREATE OR REPLACE FUNCTION scheduled_tasks_notify() RETURNS trigger AS $$
+	BEGIN
+		IF TG_OP = 'DELETE' THEN
+			PERFORM pg_notify('scheduled_tasks', json_build_object('op', TG_OP, 'hash', OLD.hash)::text);
+		ELSE
+			PERFORM pg_notify('scheduled_tasks', json_build_object('op', TG_OP, 'hash', NEW.hash)::text);
+		END IF;
+		RETURN NULL;
+	END;
+	$$ LANGUAGE plpgsql;
+
+	CREATE TRIGGER scheduled_tasks_notify
+	AFTER INSERT OR DELETE OR UPDATE OF last_run, next_run, attempt, retry_at ON scheduled_tasks
+	FOR EACH ROW EXECUTE PROCEDURE scheduled_tasks_notify();
+	`,
+	},
+	{
+		version:     6,
+		description: "Create the scheduled_task_executions table",
+		stmt: `
+	CREATE TABLE scheduled_task_executions (
+		id BIGSERIAL NOT NULL PRIMARY KEY,
+		hash text NOT NULL,
+		name text NOT NULL,
+		params jsonb NOT NULL DEFAULT '[]',
+		scheduled_at timestamptz NOT NULL,
+		started_at timestamptz NOT NULL,
+		finished_at timestamptz NOT NULL,
+		attempt integer NOT NULL,
+		outcome text NOT NULL,
+		error text NOT NULL DEFAULT ''
+	);
+	CREATE INDEX scheduled_task_executions_hash_idx ON scheduled_task_executions (hash, started_at);
+	CREATE INDEX scheduled_task_executions_finished_at_idx ON scheduled_task_executions (finished_at);
+	`,
+	},
+	{
+		version:     7,
+		description: "Add the misfire policy of scheduled_tasks",
+		stmt: `
+	ALTER TABLE scheduled_tasks ADD COLUMN misfire_policy jsonb;
+	`,
+	},
+	{
+		version:     8,
+		description: "Add the overlap policy of scheduled_tasks",
+		stmt: `
+	ALTER TABLE scheduled_tasks ADD COLUMN overlap_policy integer NOT NULL DEFAULT 0;
+	`,
+	},
+	{
+		version:     9,
+		description: "Add the first run of scheduled_tasks",
+		stmt: `
+	ALTER TABLE scheduled_tasks ADD COLUMN first_run timestamptz;
+	`,
+	},
+}
+
+// migrate applies the migrations which weren't applied to the database yet.
+func (postgres *postgresStorage) migrate(ctx context.Context) error {
+	for _, migration := range postgresMigrations {
+		if err := postgres.applyMigration(ctx, migration); err != nil {
+			return fmt.Errorf("Error while applying migration %d: %w", migration.version, err)
+		}
+	}
+	return nil
+}
+
+// applyMigration applies the migration unless it's recorded as applied. Schedulers
+// starting at the same time wait for each other on the advisory lock, which is
+// released when the transaction ends.
+func (postgres *postgresStorage) applyMigration(ctx context.Context, migration postgresMigration) error {
+	tx, err := postgres.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1);`, postgresMigrationLock); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `
+	CREATE TABLE IF NOT EXISTS scheduled_tasks_migrations (
+		version integer NOT NULL PRIMARY KEY,
+		description text NOT NULL,
+		applied_at timestamptz NOT NULL DEFAULT now()
+	);`)
+	if err != nil {
+		return err
+	}
+
+	var applied bool
+	err = tx.QueryRowContext(ctx,
+		`SELECT EXISTS (SELECT 1 FROM scheduled_tasks_migrations WHERE version = $1);`,
+		migration.version).Scan(&applied)
+	if err != nil || applied {
+		return err
+	}
+
+	if _, err := tx.ExecContext(ctx, migration.stmt); err != nil {
+		return err
+	}
+	_, err = tx.ExecContext(ctx, `INSERT INTO scheduled_tasks_migrations (version, description) VALUES ($1, $2);`,
+		migration.version, migration.description)
+	if err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	log.Printf("Applied migration %d of the task store: %s", migration.version, migration.description)
+	return nil
+}
@@ -0,0 +1,83 @@
+package storage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+// postgresChangeChannel is the channel notified by the triggers on scheduled_tasks.
+const postgresChangeChannel = "scheduled_tasks"
+
+// postgresListenerPing is how often the listener's connection is checked while no
+// notifications arrive.
+const postgresListenerPing = 90 * time.Second
+
+// postgresChange is the payload of the notifications.
+type postgresChange struct {
+	Op   string `json:"op"`
+	Hash string `json:"hash"`
+}
+
+var postgresChangeOps = map[string]TaskChangeOp{
+	"INSERT": TaskAdded,
+	"UPDATE": TaskUpdated,
+	"DELETE": TaskRemoved,
+}
+
+// Subscribe listens for the notifications sent by the triggers on scheduled_tasks, on
+// a connection of its own. The listener reconnects when the connection is lost, the
+// notifications missed meanwhile are reported as TasksMissed.
+func (postgres *postgresStorage) Subscribe(ctx context.Context) (<-chan TaskChange, error) {
+	listener := pq.NewListener(postgres.config.DbURL, 100*time.Millisecond, 10*time.Second,
+		func(event pq.ListenerEventType, err error) {
+			if err != nil {
+				log.Printf("Error while listening for task changes: %v", err)
+			}
+		})
+	if err := listener.Listen(postgresChangeChannel); err != nil {
+		listener.Close()
+		return nil, fmt.Errorf("Error while listening for task changes: %w", err)
+	}
+
+	changes := make(chan TaskChange)
+	go func() {
+		defer close(changes)
+		defer listener.Close()
+		for {
+			var change TaskChange
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(postgresListenerPing):
+				go listener.Ping()
+				continue
+			case notification := <-listener.Notify:
+				change = parsePostgresChange(notification)
+			}
+			select {
+			case changes <- change:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return changes, nil
+}
+
+// parsePostgresChange converts a notification, which is nil after reconnecting.
+func parsePostgresChange(notification *pq.Notification) TaskChange {
+	if notification == nil {
+		return TaskChange{Op: TasksMissed}
+	}
+	var payload postgresChange
+	if err := json.Unmarshal([]byte(notification.Extra), &payload); err != nil || postgresChangeOps[payload.Op] == 0 {
+		log.Printf("Invalid task change notification %q", notification.Extra)
+		return TaskChange{Op: TasksMissed}
+	}
+	return TaskChange{Op: postgresChangeOps[payload.Op], Hash: payload.Hash}
+}
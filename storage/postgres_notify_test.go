@@ -0,0 +1,64 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestParsePostgresChange(t *testing.T) {
+	tests := []struct {
+		notification *pq.Notification
+		expected     TaskChange
+	}{
+		{&pq.Notification{Extra: `{"op": "INSERT", "hash": "added"}`}, TaskChange{Op: TaskAdded, Hash: "added"}},
+		{&pq.Notification{Extra: `{"op": "UPDATE", "hash": "updated"}`}, TaskChange{Op: TaskUpdated, Hash: "updated"}},
+		{&pq.Notification{Extra: `{"op": "DELETE", "hash": "removed"}`}, TaskChange{Op: TaskRemoved, Hash: "removed"}},
+		{&pq.Notification{Extra: `{"op": "TRUNCATE"}`}, TaskChange{Op: TasksMissed}},
+		{&pq.Notification{Extra: `invalid`}, TaskChange{Op: TasksMissed}},
+		{nil, TaskChange{Op: TasksMissed}},
+	}
+	for _, test := range tests {
+		if change := parsePostgresChange(test.notification); change != test.expected {
+			t.Errorf("Expected %+v, got %+v", test.expected, change)
+		}
+	}
+}
+
+func TestPostgresStorageSubscribe(t *testing.T) {
+	_, dbURL := newTestPostgresDB(t)
+	postgres := newTestPostgresStorage(t, dbURL)
+	other := newTestPostgresStorage(t, dbURL)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	changes, err := postgres.Subscribe(ctx)
+	if err != nil {
+		t.Fatal("Subscribing should not fail: ", err)
+	}
+
+	expect := func(expected TaskChange) {
+		t.Helper()
+		select {
+		case change := <-changes:
+			if change != expected {
+				t.Errorf("Expected %+v, got %+v", expected, change)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("Expected %+v", expected)
+		}
+	}
+	now := time.Now()
+	_ = other.Add(ctx, TaskAttributes{Hash: "hash", NextRun: now.Format(time.RFC3339)})
+	expect(TaskChange{Op: TaskAdded, Hash: "hash"})
+	_ = other.Lease(ctx, "hash", "other", now, now.Add(time.Minute))
+	_ = other.Update(ctx, TaskAttributes{Hash: "hash", NextRun: now.Add(time.Hour).Format(time.RFC3339)})
+	expect(TaskChange{Op: TaskUpdated, Hash: "hash"})
+	_ = other.Remove(ctx, TaskAttributes{Hash: "hash"})
+	expect(TaskChange{Op: TaskRemoved, Hash: "hash"})
+
+	cancel()
+	for range changes {
+	}
+}
@@ -0,0 +1,352 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestPostgresDB connects to the PostgreSQL at POSTGRES_URL, e.g.
+// postgres://postgres@localhost/scheduler_test?sslmode=disable, and skips the test if
+// it isn't set. Every test uses its own schema, the returned URL connects to it.
+func newTestPostgresDB(t *testing.T) (db *sql.DB, dbURL string) {
+	baseURL := os.Getenv("POSTGRES_URL")
+	if baseURL == "" {
+		t.Skip("POSTGRES_URL is not set")
+	}
+
+	schema := fmt.Sprintf("scheduler_test_%d", time.Now().UnixNano())
+	admin, err := sql.Open("postgres", baseURL)
+	if err != nil {
+		t.Fatal("Failed to connect to PostgreSQL: ", err)
+	}
+	t.Cleanup(func() { admin.Close() })
+	if _, err := admin.Exec(`CREATE SCHEMA ` + schema); err != nil {
+		t.Fatal("Failed to create the test schema: ", err)
+	}
+	t.Cleanup(func() { _, _ = admin.Exec(`DROP SCHEMA ` + schema + ` CASCADE`) })
+
+	separator := "?"
+	if strings.Contains(baseURL, "?") {
+		separator = "&"
+	}
+	dbURL = baseURL + separator + "search_path=" + schema
+	db, err = sql.Open("postgres", dbURL)
+	if err != nil {
+		t.Fatal("Failed to connect to PostgreSQL: ", err)
+	}
+	t.Cleanup(func() { db.Close() })
+	return db, dbURL
+}
+
+func newTestPostgresStorage(t *testing.T, dbURL string) *postgresStorage {
+	postgres, err := NewPostgresStorage(PostgresDBConfig{DbURL: dbURL})
+	if err != nil {
+		t.Fatal("Failed to open the PostgreSQL storage: ", err)
+	}
+	t.Cleanup(func() { postgres.Close() })
+	return postgres
+}
+
+func TestPostgresStorageSchema(t *testing.T) {
+	db, dbURL := newTestPostgresDB(t)
+	newTestPostgresStorage(t, dbURL)
+
+	expected := map[string]string{
+		"hash":           "text",
+		"params":         "jsonb",
+		"duration":       "bigint",
+		"last_run":       "timestamp with time zone",
+		"next_run":       "timestamp with time zone",
+		"is_recurring":   "boolean",
+		"timeout":        "bigint",
+		"retry_policy":   "jsonb",
+		"attempt":        "integer",
+		"retry_at":       "timestamp with time zone",
+		"misfire_policy": "jsonb",
+		"overlap_policy": "integer",
+		"first_run":      "timestamp with time zone",
+	}
+	for column, dataType := range expected {
+		var found string
+		err := db.QueryRow(`SELECT data_type FROM information_schema.columns
+			WHERE table_schema = current_schema() AND table_name = 'scheduled_tasks' AND column_name = $1`,
+			column).Scan(&found)
+		if err != nil || found != dataType {
+			t.Errorf("Column %s should be of type %s, found %q", column, dataType, found)
+		}
+	}
+
+	for _, index := range []string{"scheduled_tasks_hash_key", "scheduled_tasks_next_run_idx",
+		"scheduled_tasks_retry_at_idx"} {
+		var exists bool
+		err := db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pg_indexes
+			WHERE schemaname = current_schema() AND indexname = $1)`, index).Scan(&exists)
+		if err != nil || !exists {
+			t.Errorf("Index %s should be created", index)
+		}
+	}
+}
+
+func TestPostgresStorageMigratesTextTable(t *testing.T) {
+	ctx := context.Background()
+	db, dbURL := newTestPostgresDB(t)
+	// The table as it was created before migrations were recorded.
+	_, err := db.Exec(`
+	CREATE TABLE scheduled_tasks (
+		id SERIAL NOT NULL PRIMARY KEY,
+		name text,
+		params text,
+		duration text,
+		last_run text,
+		next_run text,
+		is_recurring text,
+		hash text
+	);
+	INSERT INTO scheduled_tasks (name, params, duration, last_run, next_run, is_recurring, hash) VALUES
+		('Recurring', '["Hello"]', '1h30m0.5s', '2017-11-10T12:00:00Z', '2017-11-10T13:30:00Z', '1', 'recurring'),
+		('Once', '[]', '0s', '0001-01-01T00:00:00Z', '2017-11-10T12:00:00Z', '0', 'once'),
+		('Duplicate', '[]', '0s', '0001-01-01T00:00:00Z', '2017-11-10T12:00:00Z', '0', 'once');`)
+	if err != nil {
+		t.Fatal("Failed to create the text-typed table: ", err)
+	}
+
+	postgres := newTestPostgresStorage(t, dbURL)
+	tasks, err := postgres.Fetch(ctx)
+	if err != nil || len(tasks) != 2 {
+		t.Fatalf("Migrating should keep every task once, found %d: %v", len(tasks), err)
+	}
+	expected := TaskAttributes{
+		Hash:        "recurring",
+		Name:        "Recurring",
+		LastRun:     "2017-11-10T12:00:00Z",
+		NextRun:     "2017-11-10T13:30:00Z",
+		Duration:    "1h30m0.5s",
+		IsRecurring: "1",
+		Timeout:     "0s",
+		Attempt:     "0",
+		Params:      `["Hello"]`,
+	}
+	if tasks[0] != expected {
+		t.Errorf("Migrating should keep the attributes of a task, found %+v", tasks[0])
+	}
+	if tasks[1].Name != "Once" || tasks[1].LastRun != "0001-01-01T00:00:00Z" || tasks[1].IsRecurring != "0" {
+		t.Errorf("Migrating should keep the first of duplicated tasks, found %+v", tasks[1])
+	}
+
+	var lastRun sql.NullTime
+	if err := db.QueryRow(`SELECT last_run FROM scheduled_tasks WHERE hash = 'once'`).Scan(&lastRun); err != nil || lastRun.Valid {
+		t.Error("A task which never ran should be stored without a last run")
+	}
+}
+
+func TestPostgresStorageMigratesOnce(t *testing.T) {
+	ctx := context.Background()
+	db, dbURL := newTestPostgresDB(t)
+	postgres := newTestPostgresStorage(t, dbURL)
+	_ = postgres.Add(ctx, TaskAttributes{Hash: "hash", Name: "Task", Params: "[]"})
+
+	reopened := newTestPostgresStorage(t, dbURL)
+	if tasks, err := reopened.Fetch(ctx); err != nil || len(tasks) != 1 {
+		t.Error("Reopening the storage should keep its tasks")
+	}
+	var applied int
+	if err := db.QueryRow(`SELECT count(*) FROM scheduled_tasks_migrations`).Scan(&applied); err != nil ||
+		applied != len(postgresMigrations) {
+		t.Errorf("Every migration should be recorded once, found %d", applied)
+	}
+}
+
+func TestPostgresStorageAdd(t *testing.T) {
+	ctx := context.Background()
+	_, dbURL := newTestPostgresDB(t)
+	postgres := newTestPostgresStorage(t, dbURL)
+	stored := TaskAttributes{
+		Hash:          "first",
+		Name:          "First",
+		LastRun:       "2017-11-10T12:00:00Z",
+		NextRun:       "2017-11-10T12:00:05Z",
+		Duration:      "5s",
+		IsRecurring:   "1",
+		CronExpr:      "*/5 * * * *",
+		Location:      "Europe/Berlin",
+		Timeout:       "1m0s",
+		RetryPolicy:   `{"MaxAttempts": 3}`,
+		Attempt:       "1",
+		RetryAt:       "2017-11-10T12:00:01Z",
+		Params:        `["Hello"]`,
+		MisfirePolicy: `{"Mode": 2, "GraceTime": 0}`,
+		OverlapPolicy: "1",
+		FirstRun:      "2017-11-10T12:00:00Z",
+	}
+	if err := postgres.Add(ctx, stored); err != nil {
+		t.Fatal("Adding a task should not fail: ", err)
+	}
+	if err := postgres.Add(ctx, TaskAttributes{Hash: "first", Name: "Changed"}); !errors.Is(err, ErrConflict) {
+		t.Error("Adding a task with an existing hash should conflict, got: ", err)
+	}
+	if err := postgres.Add(ctx, TaskAttributes{Hash: "invalid", Duration: "invalid"}); err == nil {
+		t.Error("Adding a task with invalid attributes should fail")
+	}
+
+	tasks, err := postgres.Fetch(ctx)
+	if err != nil || len(tasks) != 1 {
+		t.Fatal("Adding a task with an existing hash should not store it")
+	}
+	if tasks[0] != stored {
+		t.Errorf("All attributes should be stored, found %+v", tasks[0])
+	}
+}
+
+func TestPostgresStorageUpdate(t *testing.T) {
+	ctx := context.Background()
+	_, dbURL := newTestPostgresDB(t)
+	postgres := newTestPostgresStorage(t, dbURL)
+	_ = postgres.Add(ctx, TaskAttributes{Hash: "hash", Name: "Task", NextRun: "2017-11-10T12:00:00Z", Duration: "5s"})
+	err := postgres.Update(ctx, TaskAttributes{Hash: "hash", LastRun: "2017-11-10T12:00:00Z",
+		NextRun: "2017-11-10T12:00:05Z", Attempt: "2", RetryAt: "2017-11-10T12:00:01Z"})
+	if err != nil {
+		t.Error("Updating a task should not fail: ", err)
+	}
+	if err := postgres.Update(ctx, TaskAttributes{Hash: "unknown"}); !errors.Is(err, ErrNotFound) {
+		t.Error("Updating an unknown task should not find it, got: ", err)
+	}
+
+	tasks, err := postgres.Fetch(ctx)
+	if err != nil || len(tasks) != 1 {
+		t.Fatal("Updating an unknown task should not add it")
+	}
+	task := tasks[0]
+	if task.NextRun != "2017-11-10T12:00:05Z" || task.LastRun != "2017-11-10T12:00:00Z" || task.Attempt != "2" ||
+		task.RetryAt != "2017-11-10T12:00:01Z" {
+		t.Errorf("Updating a task should store its run times and retry state, found %+v", task)
+	}
+	if task.Name != "Task" || task.Duration != "5s" {
+		t.Error("Updating a task should leave its other attributes untouched")
+	}
+}
+
+func TestPostgresStorageRemove(t *testing.T) {
+	ctx := context.Background()
+	_, dbURL := newTestPostgresDB(t)
+	postgres := newTestPostgresStorage(t, dbURL)
+	_ = postgres.Add(ctx, TaskAttributes{Hash: "first"})
+	_ = postgres.Add(ctx, TaskAttributes{Hash: "second"})
+
+	if err := postgres.Remove(ctx, TaskAttributes{Hash: "first"}); err != nil {
+		t.Error("Removing a task should not fail: ", err)
+	}
+	if err := postgres.Remove(ctx, TaskAttributes{Hash: "unknown"}); !errors.Is(err, ErrNotFound) {
+		t.Error("Removing an unknown task should not find it, got: ", err)
+	}
+	tasks, _ := postgres.Fetch(ctx)
+	if len(tasks) != 1 || tasks[0].Hash != "second" {
+		t.Error("Only the removed task should be gone")
+	}
+}
+
+func TestPostgresStorageFetchDue(t *testing.T) {
+	ctx := context.Background()
+	_, dbURL := newTestPostgresDB(t)
+	postgres := newTestPostgresStorage(t, dbURL)
+	_ = postgres.Add(ctx, TaskAttributes{Hash: "later", NextRun: "2017-11-10T14:00:00Z"})
+	_ = postgres.Add(ctx, TaskAttributes{Hash: "retry", NextRun: "2017-11-10T15:00:00Z", RetryAt: "2017-11-10T12:30:00Z"})
+	_ = postgres.Add(ctx, TaskAttributes{Hash: "first", NextRun: "2017-11-10T12:00:00Z"})
+	_ = postgres.Add(ctx, TaskAttributes{Hash: "second", NextRun: "2017-11-10T13:00:00Z"})
+
+	before, _ := time.Parse(time.RFC3339, "2017-11-10T14:00:00Z")
+	tasks, err := postgres.FetchDue(ctx, before, 10)
+	if err != nil || len(tasks) != 3 {
+		t.Fatalf("Only tasks due before the given time should be fetched, found %d: %v", len(tasks), err)
+	}
+	if tasks[0].Hash != "first" || tasks[1].Hash != "retry" || tasks[2].Hash != "second" {
+		t.Errorf("Due tasks should be ordered by their next run or retry, found %v", tasks)
+	}
+	if tasks, _ := postgres.FetchDue(ctx, before, 1); len(tasks) != 1 || tasks[0].Hash != "first" {
+		t.Error("At most limit due tasks should be fetched")
+	}
+}
+
+func TestPostgresStorageFetchByHash(t *testing.T) {
+	ctx := context.Background()
+	_, dbURL := newTestPostgresDB(t)
+	postgres := newTestPostgresStorage(t, dbURL)
+	_ = postgres.Add(ctx, TaskAttributes{Hash: "hash", Name: "Task"})
+
+	if task, err := postgres.FetchByHash(ctx, "hash"); err != nil || task.Name != "Task" {
+		t.Error("Fetching a task by its hash should find it, got: ", err)
+	}
+	if _, err := postgres.FetchByHash(ctx, "unknown"); !errors.Is(err, ErrNotFound) {
+		t.Error("Fetching an unknown task should not find it, got: ", err)
+	}
+}
+
+func TestPostgresStorageLease(t *testing.T) {
+	ctx := context.Background()
+	_, dbURL := newTestPostgresDB(t)
+	postgres := newTestPostgresStorage(t, dbURL)
+	_ = postgres.Add(ctx, TaskAttributes{Hash: "due", NextRun: "2017-11-10T12:00:00Z"})
+	_ = postgres.Add(ctx, TaskAttributes{Hash: "later", NextRun: "2017-11-10T13:00:00Z"})
+	now, _ := time.Parse(time.RFC3339, "2017-11-10T12:00:00Z")
+
+	if err := postgres.Lease(ctx, "due", "first", now, now.Add(time.Minute)); err != nil {
+		t.Fatal("Leasing a due task should succeed: ", err)
+	}
+	if err := postgres.Lease(ctx, "due", "second", now, now.Add(time.Minute)); !errors.Is(err, ErrNotLeased) {
+		t.Error("Leasing a task leased by another owner should fail, got: ", err)
+	}
+	if err := postgres.Lease(ctx, "later", "second", now, now.Add(time.Minute)); !errors.Is(err, ErrNotLeased) {
+		t.Error("Leasing a task which isn't due should fail, got: ", err)
+	}
+	if err := postgres.RenewLease(ctx, "due", "second", now.Add(time.Minute)); !errors.Is(err, ErrNotLeased) {
+		t.Error("Renewing a lease held by another owner should fail, got: ", err)
+	}
+	if err := postgres.RenewLease(ctx, "due", "first", now.Add(2*time.Minute)); err != nil {
+		t.Error("Renewing a held lease should succeed: ", err)
+	}
+	if err := postgres.Lease(ctx, "due", "second", now.Add(3*time.Minute), now.Add(4*time.Minute)); err != nil {
+		t.Error("Leasing a task whose lease expired should succeed: ", err)
+	}
+
+	_ = postgres.ReleaseLease(ctx, "due", "first")
+	if err := postgres.Lease(ctx, "due", "first", now, now.Add(time.Minute)); !errors.Is(err, ErrNotLeased) {
+		t.Error("Releasing a lease which was taken over should not end it")
+	}
+	_ = postgres.ReleaseLease(ctx, "due", "second")
+	if err := postgres.Lease(ctx, "due", "first", now, now.Add(time.Minute)); err != nil {
+		t.Error("Leasing a released task should succeed: ", err)
+	}
+}
+
+func TestPostgresStorageLeaderElection(t *testing.T) {
+	ctx := context.Background()
+	_, dbURL := newTestPostgresDB(t)
+	first := newTestPostgresStorage(t, dbURL)
+	second := newTestPostgresStorage(t, dbURL)
+
+	if leads, err := first.TryLead(ctx); err != nil || !leads {
+		t.Fatal("The first scheduler should lead, got: ", err)
+	}
+	if leads, err := first.TryLead(ctx); err != nil || !leads {
+		t.Error("The leader should keep leading, got: ", err)
+	}
+	if leads, err := second.TryLead(ctx); err != nil || leads {
+		t.Error("Only one scheduler should lead, got: ", err)
+	}
+
+	if err := first.Resign(ctx); err != nil {
+		t.Error("Resigning should not fail: ", err)
+	}
+	if leads, err := second.TryLead(ctx); err != nil || !leads {
+		t.Error("Another scheduler should lead once the leader resigned, got: ", err)
+	}
+	_ = second.Close()
+	if leads, err := first.TryLead(ctx); err != nil || !leads {
+		t.Error("Another scheduler should lead once the leader closed its storage, got: ", err)
+	}
+}
@@ -0,0 +1,18 @@
+package storage
+
+import (
+	"database/sql"
+	"fmt"
+)
+
+// expectRow returns err, wrapped with the task's hash, if the statement didn't affect any rows.
+func expectRow(result sql.Result, err error, hash string) error {
+	affected, rowsErr := result.RowsAffected()
+	if rowsErr != nil {
+		return rowsErr
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: %s", err, hash)
+	}
+	return nil
+}
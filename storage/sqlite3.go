@@ -0,0 +1,195 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// Sqlite3Config configures the SQLite storage. DbName is the path of the database file,
+// it's created if it doesn't exist.
+type Sqlite3Config struct {
+	DbName string
+}
+
+type sqlite3Storage struct {
+	config Sqlite3Config
+	db     *sql.DB
+}
+
+// NewSqlite3Storage opens the SQLite database and creates the `scheduled_tasks` table if
+// needed. The database runs in WAL mode so that fetching tasks doesn't block updates.
+func NewSqlite3Storage(config Sqlite3Config) (sqlite *sqlite3Storage, err error) {
+	sqlite = &sqlite3Storage{config: config}
+	err = sqlite.connect()
+	if err != nil {
+		log.Printf("Unable to open DB : %s, error : %v", config.DbName, err)
+		return nil, err
+	}
+	err = sqlite.initialize()
+	if err != nil {
+		log.Printf("Couldn't initialize the DB, error : %v", err)
+		sqlite.db.Close()
+		return nil, err
+	}
+	return sqlite, nil
+}
+
+// connect opens the database file given in the config and assigns it to the Storage field `db`.
+func (sqlite *sqlite3Storage) connect() (err error) {
+	// The busy timeout lets concurrent writers wait for each other instead of failing
+	// with SQLITE_BUSY.
+	dsn := fmt.Sprintf("file:%s?_journal_mode=WAL&_busy_timeout=5000", sqlite.config.DbName)
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return err
+	}
+	if err = db.Ping(); err != nil {
+		db.Close()
+		return err
+	}
+	sqlite.db = db
+	return nil
+}
+
+func (sqlite *sqlite3Storage) initialize() (err error) {
+	stmt := `
+	CREATE TABLE IF NOT EXISTS scheduled_tasks (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		name text,
+		params text,
+		duration text,
+		last_run text,
+		next_run text,
+		is_recurring text,
+		hash text,
+		cron_expr text NOT NULL DEFAULT '',
+		location text NOT NULL DEFAULT '',
+		timeout text NOT NULL DEFAULT '',
+		retry_policy text NOT NULL DEFAULT '',
+		attempt text NOT NULL DEFAULT '0',
+		retry_at text NOT NULL DEFAULT '',
+		misfire_policy text NOT NULL DEFAULT '',
+		overlap_policy text NOT NULL DEFAULT '',
+		first_run text NOT NULL DEFAULT ''
+	);`
+	_, err = sqlite.db.Exec(stmt)
+	if err != nil {
+		log.Printf("Error while initializing: %q - %+v", stmt, err)
+		return
+	}
+	if err = sqlite.addColumn("misfire_policy", "text NOT NULL DEFAULT ''"); err != nil {
+		return
+	}
+	if err = sqlite.addColumn("overlap_policy", "text NOT NULL DEFAULT ''"); err != nil {
+		return
+	}
+	return sqlite.addColumn("first_run", "text NOT NULL DEFAULT ''")
+}
+
+// addColumn adds a column to tables created by earlier releases, which lack it.
+func (sqlite *sqlite3Storage) addColumn(name, definition string) error {
+	var exists bool
+	err := sqlite.db.QueryRow(`SELECT EXISTS (SELECT 1 FROM pragma_table_info('scheduled_tasks') WHERE name = ?);`,
+		name).Scan(&exists)
+	if err != nil || exists {
+		return err
+	}
+	stmt := fmt.Sprintf(`ALTER TABLE scheduled_tasks ADD COLUMN %s %s;`, name, definition)
+	if _, err := sqlite.db.Exec(stmt); err != nil {
+		log.Printf("Error while initializing: %q - %+v", stmt, err)
+		return err
+	}
+	return nil
+}
+
+func (sqlite *sqlite3Storage) Close() error {
+	return sqlite.db.Close()
+}
+
+// Add inserts the task unless a task with the same hash is already stored.
+func (sqlite *sqlite3Storage) Add(ctx context.Context, task TaskAttributes) error {
+	result, err := sqlite.db.ExecContext(ctx, `
+        INSERT INTO scheduled_tasks(name, params, duration, last_run, next_run, is_recurring, cron_expr, location, timeout,
+                                    retry_policy, attempt, retry_at, misfire_policy, overlap_policy,
+                                    first_run, hash)
+        SELECT ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?
+        WHERE NOT EXISTS (SELECT 1 FROM scheduled_tasks WHERE hash = ?);`,
+		task.Name,
+		task.Params,
+		task.Duration,
+		task.LastRun,
+		task.NextRun,
+		task.IsRecurring,
+		task.CronExpr,
+		task.Location,
+		task.Timeout,
+		task.RetryPolicy,
+		task.Attempt,
+		task.RetryAt,
+		task.MisfirePolicy,
+		task.OverlapPolicy,
+		task.FirstRun,
+		task.Hash,
+		task.Hash,
+	)
+	if err != nil {
+		return fmt.Errorf("Error while inserting task: %w", err)
+	}
+	return expectRow(result, ErrConflict, task.Hash)
+}
+
+// Update stores the run times and retry state of the task.
+func (sqlite *sqlite3Storage) Update(ctx context.Context, task TaskAttributes) error {
+	result, err := sqlite.db.ExecContext(ctx, `
+        UPDATE scheduled_tasks SET last_run = ?, next_run = ?, attempt = ?, retry_at = ?
+        WHERE hash = ?;`,
+		task.LastRun,
+		task.NextRun,
+		task.Attempt,
+		task.RetryAt,
+		task.Hash,
+	)
+	if err != nil {
+		return fmt.Errorf("Error while updating task: %w", err)
+	}
+	return expectRow(result, ErrNotFound, task.Hash)
+}
+
+func (sqlite *sqlite3Storage) Fetch(ctx context.Context) ([]TaskAttributes, error) {
+	rows, err := sqlite.db.QueryContext(ctx, `
+        SELECT hash, name, params, duration, last_run, next_run, is_recurring, cron_expr, location, timeout,
+               retry_policy, attempt, retry_at, misfire_policy, overlap_policy, first_run
+        FROM scheduled_tasks ORDER BY id;`)
+	if err != nil {
+		return nil, fmt.Errorf("Error while fetching tasks: %w", err)
+	}
+	defer rows.Close()
+
+	var tasks []TaskAttributes
+	for rows.Next() {
+		task := TaskAttributes{}
+		err := rows.Scan(&task.Hash, &task.Name, &task.Params, &task.Duration, &task.LastRun, &task.NextRun,
+			&task.IsRecurring, &task.CronExpr, &task.Location, &task.Timeout, &task.RetryPolicy, &task.Attempt,
+			&task.RetryAt, &task.MisfirePolicy, &task.OverlapPolicy, &task.FirstRun)
+		if err != nil {
+			return nil, fmt.Errorf("Error while reading task: %w", err)
+		}
+		tasks = append(tasks, task)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("Error while fetching tasks: %w", err)
+	}
+	return tasks, nil
+}
+
+func (sqlite *sqlite3Storage) Remove(ctx context.Context, task TaskAttributes) error {
+	result, err := sqlite.db.ExecContext(ctx, `DELETE FROM scheduled_tasks WHERE hash = ?;`, task.Hash)
+	if err != nil {
+		return fmt.Errorf("Error while deleting task: %w", err)
+	}
+	return expectRow(result, ErrNotFound, task.Hash)
+}
@@ -0,0 +1,189 @@
+package storage
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+func newTestSqlite3Storage(t *testing.T, dbName string) *sqlite3Storage {
+	sqlite, err := NewSqlite3Storage(Sqlite3Config{DbName: dbName})
+	if err != nil {
+		t.Fatal("Failed to open the SQLite storage: ", err)
+	}
+	t.Cleanup(func() { sqlite.Close() })
+	return sqlite
+}
+
+func TestSqlite3StorageWAL(t *testing.T) {
+	sqlite := newTestSqlite3Storage(t, filepath.Join(t.TempDir(), "tasks.db"))
+
+	var journalMode string
+	if err := sqlite.db.QueryRow("PRAGMA journal_mode;").Scan(&journalMode); err != nil || journalMode != "wal" {
+		t.Errorf("The database should run in WAL mode, found %q", journalMode)
+	}
+}
+
+func TestSqlite3StorageAdd(t *testing.T) {
+	ctx := context.Background()
+	sqlite := newTestSqlite3Storage(t, filepath.Join(t.TempDir(), "tasks.db"))
+	stored := TaskAttributes{
+		Hash:          "first",
+		Name:          "First",
+		LastRun:       "2017-11-10T12:00:00Z",
+		NextRun:       "2017-11-10T12:00:05Z",
+		Duration:      "5s",
+		IsRecurring:   "1",
+		CronExpr:      "*/5 * * * *",
+		Location:      "Europe/Berlin",
+		Timeout:       "1m0s",
+		RetryPolicy:   `{"MaxAttempts":3}`,
+		Attempt:       "1",
+		RetryAt:       "2017-11-10T12:00:01Z",
+		Params:        `["Hello"]`,
+		MisfirePolicy: `{"Mode":2,"GraceTime":0}`,
+		OverlapPolicy: "1",
+		FirstRun:      "2017-11-10T12:00:00Z",
+	}
+	_ = sqlite.Add(ctx, stored)
+	_ = sqlite.Add(ctx, TaskAttributes{Hash: "second", Name: "Second"})
+	if err := sqlite.Add(ctx, TaskAttributes{Hash: "first", Name: "Changed"}); !errors.Is(err, ErrConflict) {
+		t.Error("Adding a task with an existing hash should conflict, got: ", err)
+	}
+
+	tasks, err := sqlite.Fetch(ctx)
+	if err != nil || len(tasks) != 2 {
+		t.Fatal("Adding a task with an existing hash should not store it")
+	}
+	if tasks[0] != stored {
+		t.Errorf("All attributes should be stored, found %+v", tasks[0])
+	}
+	if tasks[1].Name != "Second" {
+		t.Error("Tasks should be fetched in the order they were added")
+	}
+}
+
+func TestSqlite3StorageUpdate(t *testing.T) {
+	ctx := context.Background()
+	sqlite := newTestSqlite3Storage(t, filepath.Join(t.TempDir(), "tasks.db"))
+	_ = sqlite.Add(ctx, TaskAttributes{Hash: "hash", Name: "Task", NextRun: "before", Duration: "5s"})
+	_ = sqlite.Update(ctx, TaskAttributes{Hash: "hash", Name: "Other", NextRun: "after", LastRun: "before", Duration: "1s",
+		Attempt: "2", RetryAt: "soon"})
+	if err := sqlite.Update(ctx, TaskAttributes{Hash: "unknown", NextRun: "after"}); !errors.Is(err, ErrNotFound) {
+		t.Error("Updating an unknown task should not find it, got: ", err)
+	}
+
+	tasks, err := sqlite.Fetch(ctx)
+	if err != nil || len(tasks) != 1 {
+		t.Fatal("Updating an unknown task should not add it")
+	}
+	task := tasks[0]
+	if task.NextRun != "after" || task.LastRun != "before" || task.Attempt != "2" || task.RetryAt != "soon" {
+		t.Error("Updating a task should store its run times and retry state")
+	}
+	if task.Name != "Task" || task.Duration != "5s" {
+		t.Error("Updating a task should leave its other attributes untouched")
+	}
+}
+
+func TestSqlite3StorageRemove(t *testing.T) {
+	ctx := context.Background()
+	sqlite := newTestSqlite3Storage(t, filepath.Join(t.TempDir(), "tasks.db"))
+	_ = sqlite.Add(ctx, TaskAttributes{Hash: "first"})
+	_ = sqlite.Add(ctx, TaskAttributes{Hash: "second"})
+
+	if err := sqlite.Remove(ctx, TaskAttributes{Hash: "first"}); err != nil {
+		t.Error("Removing a task should not fail: ", err)
+	}
+	if err := sqlite.Remove(ctx, TaskAttributes{Hash: "unknown"}); !errors.Is(err, ErrNotFound) {
+		t.Error("Removing an unknown task should not find it, got: ", err)
+	}
+	tasks, _ := sqlite.Fetch(ctx)
+	if len(tasks) != 1 || tasks[0].Hash != "second" {
+		t.Error("Only the removed task should be gone")
+	}
+}
+
+func TestSqlite3StoragePersists(t *testing.T) {
+	ctx := context.Background()
+	dbName := filepath.Join(t.TempDir(), "tasks.db")
+	sqlite, err := NewSqlite3Storage(Sqlite3Config{DbName: dbName})
+	if err != nil {
+		t.Fatal("Failed to open the SQLite storage: ", err)
+	}
+	_ = sqlite.Add(ctx, TaskAttributes{Hash: "hash", Name: "Task"})
+	if err := sqlite.Close(); err != nil {
+		t.Error("Closing the storage should not fail: ", err)
+	}
+
+	reopened := newTestSqlite3Storage(t, dbName)
+	tasks, err := reopened.Fetch(ctx)
+	if err != nil || len(tasks) != 1 || tasks[0].Name != "Task" {
+		t.Error("Tasks should survive reopening the database")
+	}
+}
+
+func TestSqlite3StorageAddsColumns(t *testing.T) {
+	ctx := context.Background()
+	dbName := filepath.Join(t.TempDir(), "tasks.db")
+	db, err := sql.Open("sqlite3", dbName)
+	if err != nil {
+		t.Fatal("Failed to open the database: ", err)
+	}
+	// The table as created by the release before misfire policies.
+	_, err = db.Exec(`
+	CREATE TABLE scheduled_tasks (
+		id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+		name text, params text, duration text, last_run text, next_run text, is_recurring text, hash text,
+		cron_expr text NOT NULL DEFAULT '', location text NOT NULL DEFAULT '', timeout text NOT NULL DEFAULT '',
+		retry_policy text NOT NULL DEFAULT '', attempt text NOT NULL DEFAULT '0', retry_at text NOT NULL DEFAULT ''
+	);
+	INSERT INTO scheduled_tasks (name, params, duration, last_run, next_run, is_recurring, hash)
+	VALUES ('Task', '[]', '0s', '', '', '0', 'hash');`)
+	db.Close()
+	if err != nil {
+		t.Fatal("Failed to create the table: ", err)
+	}
+
+	sqlite := newTestSqlite3Storage(t, dbName)
+	_ = sqlite.Add(ctx, TaskAttributes{Hash: "skipped", Name: "Skipped", MisfirePolicy: `{"Mode":2}`})
+	tasks, err := sqlite.Fetch(ctx)
+	if err != nil || len(tasks) != 2 {
+		t.Fatal("Tasks should be fetched from tables of earlier releases, got: ", err)
+	}
+	if tasks[0].MisfirePolicy != "" || tasks[1].MisfirePolicy != `{"Mode":2}` {
+		t.Errorf("The misfire policy should be stored, found %+v", tasks)
+	}
+}
+
+func TestSqlite3StorageConcurrentUse(t *testing.T) {
+	ctx := context.Background()
+	sqlite := newTestSqlite3Storage(t, filepath.Join(t.TempDir(), "tasks.db"))
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 25; j++ {
+				task := TaskAttributes{Hash: string(rune('a' + j%10))}
+				if err := sqlite.Add(ctx, task); err != nil && !errors.Is(err, ErrConflict) {
+					t.Error("Adding a task concurrently should not fail: ", err)
+				}
+				if err := sqlite.Update(ctx, task); err != nil {
+					t.Error("Updating a task concurrently should not fail: ", err)
+				}
+				if _, err := sqlite.Fetch(ctx); err != nil {
+					t.Error("Fetching tasks concurrently should not fail: ", err)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if tasks, _ := sqlite.Fetch(ctx); len(tasks) != 10 {
+		t.Errorf("Every hash should be stored once, found %d tasks", len(tasks))
+	}
+}
@@ -1,8 +1,24 @@
 package storage
 
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+var (
+	// ErrNotFound is returned when no task with the given hash is stored.
+	ErrNotFound = errors.New("Task not found")
+	// ErrConflict is returned when adding a task whose hash is already stored.
+	ErrConflict = errors.New("Task already exists")
+	// ErrNotLeased is returned when a task can't be leased, or its lease was lost.
+	ErrNotLeased = errors.New("Task not leased")
+)
+
 // TaskAttributes is a struct which is used to transfer data from/to stores.
 // All task data are converted from/to string to prevent the store from
 // worrying about details of converting data to the proper formats.
+// Params holds the JSON array of the task's params.
 type TaskAttributes struct {
 	Hash        string
 	Name        string
@@ -10,10 +26,115 @@ type TaskAttributes struct {
 	NextRun     string
 	Duration    string
 	IsRecurring string
-	Params      []string
+	CronExpr    string
+	Location    string
+	Timeout     string
+	RetryPolicy string
+	Attempt     string
+	RetryAt     string
+	Params      string
+	// MisfirePolicy holds the JSON encoded misfire policy, empty for the default one.
+	MisfirePolicy string
+	// OverlapPolicy holds the overlap policy as a decimal number, empty for the default one.
+	OverlapPolicy string
+	// FirstRun holds the first run of a recurring task, empty for tasks stored by
+	// earlier releases.
+	FirstRun string
+}
+
+// ContextTaskStore is the interface to implement when adding custom task storage.
+// Errors are wrapped around ErrNotFound and ErrConflict where they apply, so that
+// they can be checked with errors.Is.
+type ContextTaskStore interface {
+	// Add stores the task, or returns ErrConflict if a task with the same hash is stored.
+	Add(context.Context, TaskAttributes) error
+	// Update stores the run times and retry state of the task, or returns ErrNotFound
+	// if it isn't stored. Stores which upsert never return ErrNotFound.
+	Update(context.Context, TaskAttributes) error
+	// Fetch returns all stored tasks.
+	Fetch(context.Context) ([]TaskAttributes, error)
+	// Remove deletes the task, or returns ErrNotFound if it isn't stored.
+	Remove(context.Context, TaskAttributes) error
+	Close() error
+}
+
+// DueTaskStore is implemented by stores which can look up tasks by the time they're
+// due and by their hash. The scheduler then only keeps the tasks which are due soon
+// in memory, instead of fetching all tasks whenever it refreshes.
+type DueTaskStore interface {
+	ContextTaskStore
+	// FetchDue returns at most limit tasks whose next run or retry is before the given
+	// time, ordered by the earlier of the two.
+	FetchDue(ctx context.Context, before time.Time, limit int) ([]TaskAttributes, error)
+	// FetchByHash returns the task with the given hash, or ErrNotFound if it isn't stored.
+	FetchByHash(ctx context.Context, hash string) (TaskAttributes, error)
+}
+
+// LeasingTaskStore is implemented by stores which can be shared by several schedulers.
+// A scheduler leases a task before running it, so that every run happens on a single
+// scheduler, and renews the lease while the task runs. Leases which aren't renewed
+// expire, so that the tasks of a scheduler which stopped are taken over by the others.
+// Leases are compared against the schedulers' clocks, which have to be in sync.
+type LeasingTaskStore interface {
+	ContextTaskStore
+	// Lease claims the task for owner until the given time. It returns ErrNotLeased if
+	// the task isn't stored, isn't due at now, or is leased by another owner whose
+	// lease didn't expire at now. Owners may lease the tasks they already lease.
+	Lease(ctx context.Context, hash, owner string, now, until time.Time) error
+	// RenewLease extends the lease held by owner until the given time, or returns
+	// ErrNotLeased if owner doesn't hold it anymore.
+	RenewLease(ctx context.Context, hash, owner string, until time.Time) error
+	// ReleaseLease ends the lease held by owner, if it still holds it.
+	ReleaseLease(ctx context.Context, hash, owner string) error
+}
+
+// LeaderElector is implemented by stores which can elect one of the schedulers
+// sharing them as the leader, which is then the only one running tasks.
+type LeaderElector interface {
+	// TryLead makes the caller the leader unless another one leads, and reports
+	// whether the caller leads. Leaders call it periodically to find out whether
+	// they still lead.
+	TryLead(ctx context.Context) (bool, error)
+	// Resign ends the caller's leadership, if it leads.
+	Resign(ctx context.Context) error
+}
+
+// TaskChangeOp is the kind of a TaskChange.
+type TaskChangeOp int
+
+const (
+	// TaskAdded means that the task was added.
+	TaskAdded TaskChangeOp = iota + 1
+	// TaskUpdated means that the run times or retry state of the task changed.
+	TaskUpdated
+	// TaskRemoved means that the task was removed.
+	TaskRemoved
+	// TasksMissed means that changes may have been missed, e.g. while reconnecting,
+	// so that all tasks have to be loaded again. Its Hash is empty.
+	TasksMissed
+)
+
+// TaskChange describes a change of a stored task, made by any of the schedulers
+// sharing the store.
+type TaskChange struct {
+	Op   TaskChangeOp
+	Hash string
+}
+
+// ChangeNotifier is implemented by stores which notify schedulers about the changes
+// of their tasks, so that tasks added, updated or removed by other schedulers sharing
+// the store are applied right away. Changed tasks are fetched by their hash.
+type ChangeNotifier interface {
+	DueTaskStore
+	// Subscribe returns a channel receiving the changes of tasks until ctx is done,
+	// the channel is closed then.
+	Subscribe(ctx context.Context) (<-chan TaskChange, error)
 }
 
-// TaskStore is the interface to implement when adding custom task storage.
+// TaskStore is the previous version of ContextTaskStore.
+//
+// Deprecated: Implement ContextTaskStore instead. Existing implementations can be
+// passed to the scheduler through AdaptTaskStore.
 type TaskStore interface {
 	Add(TaskAttributes) error
 	Update(TaskAttributes) error
@@ -0,0 +1,124 @@
+package storage
+
+import (
+	"strconv"
+	"time"
+)
+
+// typedTask holds the attributes of a task in their native types, for stores which
+// don't keep them as strings. Empty attributes are converted to zero values, and
+// RetryAt is nil unless a retry is scheduled. The bson tags name the fields of the
+// documents stored by the MongoDB store.
+type typedTask struct {
+	Hash          string        `bson:"hash"`
+	Name          string        `bson:"name"`
+	Params        string        `bson:"params"`
+	Duration      time.Duration `bson:"duration"`
+	LastRun       time.Time     `bson:"last_run"`
+	NextRun       time.Time     `bson:"next_run"`
+	IsRecurring   bool          `bson:"is_recurring"`
+	CronExpr      string        `bson:"cron_expr"`
+	Location      string        `bson:"location"`
+	Timeout       time.Duration `bson:"timeout"`
+	RetryPolicy   string        `bson:"retry_policy"`
+	Attempt       int64         `bson:"attempt"`
+	RetryAt       *time.Time    `bson:"retry_at"`
+	MisfirePolicy string        `bson:"misfire_policy"`
+	OverlapPolicy int64         `bson:"overlap_policy"`
+	FirstRun      time.Time     `bson:"first_run"`
+}
+
+// newTypedTask parses the string attributes of a task.
+func newTypedTask(task TaskAttributes) (document typedTask, err error) {
+	document = typedTask{
+		Hash:          task.Hash,
+		Name:          task.Name,
+		Params:        task.Params,
+		IsRecurring:   task.IsRecurring == "1",
+		CronExpr:      task.CronExpr,
+		Location:      task.Location,
+		RetryPolicy:   task.RetryPolicy,
+		MisfirePolicy: task.MisfirePolicy,
+	}
+	if document.LastRun, err = parseAttributeTime(task.LastRun); err != nil {
+		return typedTask{}, err
+	}
+	if document.NextRun, err = parseAttributeTime(task.NextRun); err != nil {
+		return typedTask{}, err
+	}
+	if document.FirstRun, err = parseAttributeTime(task.FirstRun); err != nil {
+		return typedTask{}, err
+	}
+	if task.RetryAt != "" {
+		retryAt, err := parseAttributeTime(task.RetryAt)
+		if err != nil {
+			return typedTask{}, err
+		}
+		document.RetryAt = &retryAt
+	}
+	if document.Duration, err = parseAttributeDuration(task.Duration); err != nil {
+		return typedTask{}, err
+	}
+	if document.Timeout, err = parseAttributeDuration(task.Timeout); err != nil {
+		return typedTask{}, err
+	}
+	if task.Attempt != "" {
+		if document.Attempt, err = strconv.ParseInt(task.Attempt, 10, 64); err != nil {
+			return typedTask{}, err
+		}
+	}
+	if task.OverlapPolicy != "" {
+		if document.OverlapPolicy, err = strconv.ParseInt(task.OverlapPolicy, 10, 64); err != nil {
+			return typedTask{}, err
+		}
+	}
+	return document, nil
+}
+
+// attributes converts the task back to the string attributes read by the scheduler.
+func (document typedTask) attributes() TaskAttributes {
+	isRecurring := "0"
+	if document.IsRecurring {
+		isRecurring = "1"
+	}
+	retryAt := ""
+	if document.RetryAt != nil {
+		retryAt = document.RetryAt.UTC().Format(time.RFC3339)
+	}
+	firstRun := ""
+	if !document.FirstRun.IsZero() {
+		firstRun = document.FirstRun.UTC().Format(time.RFC3339)
+	}
+	return TaskAttributes{
+		Hash:          document.Hash,
+		Name:          document.Name,
+		LastRun:       document.LastRun.UTC().Format(time.RFC3339),
+		NextRun:       document.NextRun.UTC().Format(time.RFC3339),
+		Duration:      document.Duration.String(),
+		IsRecurring:   isRecurring,
+		CronExpr:      document.CronExpr,
+		Location:      document.Location,
+		Timeout:       document.Timeout.String(),
+		RetryPolicy:   document.RetryPolicy,
+		Attempt:       strconv.FormatInt(document.Attempt, 10),
+		RetryAt:       retryAt,
+		Params:        document.Params,
+		MisfirePolicy: document.MisfirePolicy,
+		OverlapPolicy: strconv.FormatInt(document.OverlapPolicy, 10),
+		FirstRun:      firstRun,
+	}
+}
+
+func parseAttributeTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+func parseAttributeDuration(value string) (time.Duration, error) {
+	if value == "" {
+		return 0, nil
+	}
+	return time.ParseDuration(value)
+}
@@ -0,0 +1,18 @@
+package storage
+
+import "testing"
+
+func TestTypedTaskInvalidAttributes(t *testing.T) {
+	for _, attributes := range []TaskAttributes{
+		{LastRun: "invalid"},
+		{NextRun: "invalid"},
+		{RetryAt: "invalid"},
+		{Duration: "invalid"},
+		{Timeout: "invalid"},
+		{Attempt: "invalid"},
+	} {
+		if _, err := newTypedTask(attributes); err == nil {
+			t.Errorf("Converting %+v should fail", attributes)
+		}
+	}
+}
@@ -1,7 +1,12 @@
 package scheduler
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"github.com/ClubNFT/scheduler/config"
+	"log"
 	"strconv"
 	"time"
 
@@ -10,70 +15,237 @@ import (
 )
 
 type storeBridge struct {
-	store       storage.TaskStore
+	store       storage.ContextTaskStore
 	funcManager config.FunctionManager
 }
 
-func (sb *storeBridge) Add(task *task.Task) error {
+func (sb *storeBridge) Add(ctx context.Context, task *task.Task) error {
 	attributes, err := sb.getTaskAttributes(task)
 	if err != nil {
 		return err
 	}
-	return sb.store.Add(attributes)
+	return sb.store.Add(ctx, attributes)
 }
 
-func (sb *storeBridge) Update(task *task.Task) error {
+func (sb *storeBridge) Update(ctx context.Context, task *task.Task) error {
 	attributes, err := sb.getTaskAttributes(task)
 	if err != nil {
 		return err
 	}
-	return sb.store.Update(attributes)
+	return sb.store.Update(ctx, attributes)
 }
 
-func (sb *storeBridge) Fetch() ([]*task.Task, error) {
-	storedTasks, err := sb.store.Fetch()
+func (sb *storeBridge) Fetch(ctx context.Context) ([]*task.Task, error) {
+	storedTasks, err := sb.store.Fetch(ctx)
 	if err != nil {
 		return []*task.Task{}, err
 	}
+	return sb.getTasks(ctx, storedTasks), nil
+}
+
+// dueStore returns the store if it can look up tasks by the time they're due.
+func (sb *storeBridge) dueStore() (storage.DueTaskStore, bool) {
+	store, ok := sb.store.(storage.DueTaskStore)
+	return store, ok
+}
+
+// leasingStore returns the store if it can be shared by several schedulers.
+func (sb *storeBridge) leasingStore() (storage.LeasingTaskStore, bool) {
+	store, ok := sb.store.(storage.LeasingTaskStore)
+	return store, ok
+}
+
+// FetchDue returns at most limit tasks which are due before the given time. The store
+// has to implement storage.DueTaskStore.
+func (sb *storeBridge) FetchDue(ctx context.Context, before time.Time, limit int) ([]*task.Task, error) {
+	store, _ := sb.dueStore()
+	storedTasks, err := store.FetchDue(ctx, before, limit)
+	if err != nil {
+		return nil, err
+	}
+	return sb.getTasks(ctx, storedTasks), nil
+}
+
+// FetchByHash returns the task with the given ID. The store has to implement
+// storage.DueTaskStore.
+func (sb *storeBridge) FetchByHash(ctx context.Context, taskID task.ID) (*task.Task, error) {
+	store, _ := sb.dueStore()
+	storedTask, err := store.FetchByHash(ctx, string(taskID))
+	if err != nil {
+		return nil, err
+	}
+	t, err := sb.getTask(storedTask)
+	if err != nil {
+		return nil, err
+	}
+	if string(t.Hash()) != storedTask.Hash {
+		sb.rekey(ctx, storedTask, t)
+	}
+	return t, nil
+}
+
+// getTasks returns the stored tasks. Tasks which can't be loaded, e.g. because their
+// function isn't registered in the stub mapping anymore, are logged and skipped.
+func (sb *storeBridge) getTasks(ctx context.Context, storedTasks []storage.TaskAttributes) []*task.Task {
 	var tasks []*task.Task
 	for _, storedTask := range storedTasks {
-		lastRun, err := time.Parse(time.RFC3339, storedTask.LastRun)
+		t, err := sb.getTask(storedTask)
 		if err != nil {
+			log.Printf("Skipping stored task %s of function %s: %v", storedTask.Hash, storedTask.Name, err)
+			continue
+		}
+		if string(t.Hash()) != storedTask.Hash {
+			sb.rekey(ctx, storedTask, t)
+		}
+		tasks = append(tasks, t)
+	}
+	return tasks
+}
+
+// getTask decodes a stored task.
+func (sb *storeBridge) getTask(storedTask storage.TaskAttributes) (*task.Task, error) {
+	lastRun, err := time.Parse(time.RFC3339, storedTask.LastRun)
+	if err != nil {
+		return nil, err
+	}
+
+	nextRun, err := time.Parse(time.RFC3339, storedTask.NextRun)
+	if err != nil {
+		return nil, err
+	}
+
+	duration, err := time.ParseDuration(storedTask.Duration)
+	if err != nil {
+		return nil, err
+	}
+
+	isRecurring, err := strconv.Atoi(storedTask.IsRecurring)
+	if err != nil {
+		return nil, err
+	}
+
+	if storedTask.CronExpr != "" {
+		if _, err := task.ParseCron(storedTask.CronExpr); err != nil {
 			return nil, err
 		}
+	}
 
-		nextRun, err := time.Parse(time.RFC3339, storedTask.NextRun)
+	var timeout time.Duration
+	if storedTask.Timeout != "" {
+		timeout, err = time.ParseDuration(storedTask.Timeout)
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	var retryPolicy task.RetryPolicy
+	if storedTask.RetryPolicy != "" {
+		if err := json.Unmarshal([]byte(storedTask.RetryPolicy), &retryPolicy); err != nil {
+			return nil, err
+		}
+	}
 
-		duration, err := time.ParseDuration(storedTask.Duration)
+	var misfirePolicy task.MisfirePolicy
+	if storedTask.MisfirePolicy != "" {
+		if err := json.Unmarshal([]byte(storedTask.MisfirePolicy), &misfirePolicy); err != nil {
+			return nil, err
+		}
+	}
+
+	var overlapPolicy int
+	if storedTask.OverlapPolicy != "" {
+		overlapPolicy, err = strconv.Atoi(storedTask.OverlapPolicy)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		isRecurring, err := strconv.Atoi(storedTask.IsRecurring)
+	var attempt int
+	if storedTask.Attempt != "" {
+		attempt, err = strconv.Atoi(storedTask.Attempt)
 		if err != nil {
 			return nil, err
 		}
+	}
 
-		t := task.NewWithSchedule(task.FunctionMeta{Name: storedTask.Name}, storedTask.Params, task.Schedule{
-			IsRecurring: isRecurring == 1,
-			Duration:    time.Duration(duration),
-			LastRun:     lastRun,
-			NextRun:     nextRun,
-		}, sb.funcManager)
-		tasks = append(tasks, t)
+	var retryAt time.Time
+	if storedTask.RetryAt != "" {
+		retryAt, err = time.Parse(time.RFC3339, storedTask.RetryAt)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	var firstRun time.Time
+	if storedTask.FirstRun != "" {
+		firstRun, err = time.Parse(time.RFC3339, storedTask.FirstRun)
+		if err != nil {
+			return nil, err
+		}
 	}
-	return tasks, nil
+
+	var location *time.Location
+	if storedTask.Location != "" {
+		location, err = time.LoadLocation(storedTask.Location)
+		if err != nil {
+			return nil, err
+		}
+		lastRun = lastRun.In(location)
+		nextRun = nextRun.In(location)
+		firstRun = firstRun.In(location)
+	}
+
+	function, ok := sb.funcManager.Get(storedTask.Name)
+	if !ok {
+		return nil, fmt.Errorf("Function %s is not registered in the stub mapping", storedTask.Name)
+	}
+	funcMeta, err := task.NewFunctionMeta(storedTask.Name, function)
+	if err != nil {
+		return nil, err
+	}
+	params, err := task.DecodeParams(storedTask.Params, funcMeta.Params())
+	if err != nil {
+		return nil, err
+	}
+
+	t := task.NewWithSchedule(funcMeta, params, task.Schedule{
+		IsRecurring: isRecurring == 1,
+		Duration:    time.Duration(duration),
+		LastRun:     lastRun,
+		NextRun:     nextRun,
+		CronExpr:    storedTask.CronExpr,
+		Location:    location,
+		FirstRun:    firstRun,
+		Attempt:     attempt,
+		RetryAt:     retryAt,
+	}, sb.funcManager)
+	t.Timeout = timeout
+	t.Retry = retryPolicy
+	t.Misfire = misfirePolicy
+	t.Overlap = task.OverlapPolicy(overlapPolicy)
+	return t, nil
 }
 
-func (sb *storeBridge) Remove(task *task.Task) error {
+// rekey stores a task again under its ID, after it was stored under the ID an
+// earlier version computed for it. Tasks which are stored under their ID already
+// are dropped as duplicates.
+func (sb *storeBridge) rekey(ctx context.Context, stored storage.TaskAttributes, t *task.Task) {
+	log.Printf("Storing task %s under its new ID %s", stored.Hash, t.Hash())
+	if err := sb.store.Remove(ctx, stored); err != nil {
+		log.Printf("Error while removing task %s: %v", stored.Hash, err)
+		return
+	}
+	if err := sb.Add(ctx, t); err != nil && !errors.Is(err, storage.ErrConflict) {
+		log.Printf("Error while storing task %s: %v", t.Hash(), err)
+	}
+}
+
+func (sb *storeBridge) Remove(ctx context.Context, task *task.Task) error {
 	attributes, err := sb.getTaskAttributes(task)
 	if err != nil {
 		return err
 	}
-	return sb.store.Remove(attributes)
+	return sb.store.Remove(ctx, attributes)
 }
 
 func (sb *storeBridge) getTaskAttributes(task *task.Task) (storage.TaskAttributes, error) {
@@ -82,13 +254,65 @@ func (sb *storeBridge) getTaskAttributes(task *task.Task) (storage.TaskAttribute
 		isRecurring = 1
 	}
 
+	location := ""
+	if task.Location != nil {
+		location = task.Location.String()
+	}
+
+	retryPolicy := ""
+	if task.Retry.MaxAttempts > 0 {
+		encoded, err := json.Marshal(task.Retry)
+		if err != nil {
+			return storage.TaskAttributes{}, err
+		}
+		retryPolicy = string(encoded)
+	}
+
+	misfirePolicy := ""
+	if task.Misfire.Mode != 0 || task.Misfire.GraceTime != 0 {
+		encoded, err := json.Marshal(task.Misfire)
+		if err != nil {
+			return storage.TaskAttributes{}, err
+		}
+		misfirePolicy = string(encoded)
+	}
+
+	overlapPolicy := ""
+	if task.Overlap != 0 {
+		overlapPolicy = strconv.Itoa(int(task.Overlap))
+	}
+
+	params, err := task.EncodeParams()
+	if err != nil {
+		return storage.TaskAttributes{}, err
+	}
+
+	retryAt := ""
+	if !task.RetryAt.IsZero() {
+		retryAt = task.RetryAt.Format(time.RFC3339)
+	}
+
+	firstRun := ""
+	if !task.FirstRun.IsZero() {
+		firstRun = task.FirstRun.Format(time.RFC3339)
+	}
+
 	return storage.TaskAttributes{
-		Hash:        string(task.Hash()),
-		Name:        task.Func.Name,
-		LastRun:     task.LastRun.Format(time.RFC3339),
-		NextRun:     task.NextRun.Format(time.RFC3339),
-		Duration:    task.Duration.String(),
-		IsRecurring: strconv.Itoa(isRecurring),
-		Params:      task.Params,
+		Hash:          string(task.Hash()),
+		Name:          task.Func.Name,
+		LastRun:       task.LastRun.Format(time.RFC3339),
+		NextRun:       task.NextRun.Format(time.RFC3339),
+		Duration:      task.Duration.String(),
+		IsRecurring:   strconv.Itoa(isRecurring),
+		CronExpr:      task.CronExpr,
+		Location:      location,
+		Timeout:       task.Timeout.String(),
+		RetryPolicy:   retryPolicy,
+		Attempt:       strconv.Itoa(task.Attempt),
+		RetryAt:       retryAt,
+		Params:        params,
+		MisfirePolicy: misfirePolicy,
+		OverlapPolicy: overlapPolicy,
+		FirstRun:      firstRun,
 	}, nil
 }
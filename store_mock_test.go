@@ -0,0 +1,134 @@
+package scheduler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync/atomic"
+	"time"
+
+	"github.com/ClubNFT/scheduler/storage"
+)
+
+const mockFunctionName = "github.com/ClubNFT/scheduler.mockFunction"
+
+func mockFunction(arg string) {}
+
+type storeMockMode int
+
+const (
+	fail storeMockMode = iota
+	failOnLastRun
+	failOnNextRun
+	failOnDuration
+	failOnIsRecurring
+	failOnFuncMeta
+	failOnEmptyParams
+	failOnEmptyListParams
+)
+
+// storeMock returns a single stored task which is broken according to Mode.
+type storeMock struct {
+	Mode storeMockMode
+}
+
+func newStoreMockWithMode(mode storeMockMode) *storeMock {
+	return &storeMock{Mode: mode}
+}
+
+func (mock *storeMock) Add(context.Context, storage.TaskAttributes) error    { return nil }
+func (mock *storeMock) Update(context.Context, storage.TaskAttributes) error { return nil }
+func (mock *storeMock) Remove(context.Context, storage.TaskAttributes) error { return nil }
+func (mock *storeMock) Close() error                                         { return nil }
+
+func (mock *storeMock) Fetch(context.Context) ([]storage.TaskAttributes, error) {
+	attributes := storage.TaskAttributes{
+		Hash:        "TestHash",
+		Name:        mockFunctionName,
+		LastRun:     "2017-11-10T12:00:00Z",
+		NextRun:     "2017-11-10T12:00:00Z",
+		Duration:    "5s",
+		IsRecurring: "0",
+		Params:      `["Hello"]`,
+	}
+
+	switch mock.Mode {
+	case fail:
+		return nil, errors.New("Fetching failed")
+	case failOnLastRun:
+		attributes.LastRun = "invalid"
+	case failOnNextRun:
+		attributes.NextRun = "invalid"
+	case failOnDuration:
+		attributes.Duration = "invalid"
+	case failOnIsRecurring:
+		attributes.IsRecurring = "invalid"
+	case failOnFuncMeta:
+		attributes.Name = "github.com/ClubNFT/scheduler.unknownFunction"
+	case failOnEmptyParams:
+		attributes.Params = ""
+	case failOnEmptyListParams:
+		attributes.Params = "[]"
+	}
+	return []storage.TaskAttributes{attributes}, nil
+}
+
+// legacyStore implements the deprecated storage.TaskStore without storing anything.
+type legacyStore struct{}
+
+func (store *legacyStore) Add(storage.TaskAttributes) error    { return nil }
+func (store *legacyStore) Update(storage.TaskAttributes) error { return nil }
+func (store *legacyStore) Remove(storage.TaskAttributes) error { return nil }
+func (store *legacyStore) Close() error                        { return nil }
+
+func (store *legacyStore) Fetch() ([]storage.TaskAttributes, error) {
+	return nil, nil
+}
+
+// dueStore adds storage.DueTaskStore to a MemoryStorage and counts the calls to Fetch,
+// which shouldn't be needed when tasks can be fetched by the time they're due.
+type dueStore struct {
+	*storage.MemoryStorage
+	fetches int32
+}
+
+func newDueStore() *dueStore {
+	return &dueStore{MemoryStorage: storage.NewMemoryStorage()}
+}
+
+func (store *dueStore) Fetch(ctx context.Context) ([]storage.TaskAttributes, error) {
+	atomic.AddInt32(&store.fetches, 1)
+	return store.MemoryStorage.Fetch(ctx)
+}
+
+func (store *dueStore) FetchDue(ctx context.Context, before time.Time, limit int) ([]storage.TaskAttributes, error) {
+	earliest := func(attributes storage.TaskAttributes) time.Time {
+		nextRun, _ := time.Parse(time.RFC3339Nano, attributes.NextRun)
+		if retryAt, err := time.Parse(time.RFC3339Nano, attributes.RetryAt); err == nil && retryAt.Before(nextRun) {
+			return retryAt
+		}
+		return nextRun
+	}
+
+	var due []storage.TaskAttributes
+	for _, attributes := range store.Snapshot() {
+		if earliest(attributes).Before(before) {
+			due = append(due, attributes)
+		}
+	}
+	sort.SliceStable(due, func(i, j int) bool {
+		return earliest(due[i]).Before(earliest(due[j]))
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+	return due, nil
+}
+
+func (store *dueStore) FetchByHash(ctx context.Context, hash string) (storage.TaskAttributes, error) {
+	if attributes, ok := store.Get(hash); ok {
+		return attributes, nil
+	}
+	return storage.TaskAttributes{}, fmt.Errorf("%w: %s", storage.ErrNotFound, hash)
+}
@@ -1,19 +1,21 @@
 package scheduler
 
 import (
+	"context"
 	"testing"
 
+	"github.com/ClubNFT/scheduler/config"
 	"github.com/ClubNFT/scheduler/storage"
 	"github.com/ClubNFT/scheduler/task"
 )
 
 func TestStore(t *testing.T) {
 	mock := task.CallbackMock{}
-	funcRegistry := task.NewFuncRegistry()
-	store := getStoreBridge(funcRegistry, nil)
-	task := newTask(funcRegistry, mock.CallNoArgs)
+	stubs := mockStubs(mock.CallNoArgs)
+	store := getStoreBridge(stubs, nil)
+	task := newTask(mock.CallNoArgs)
 	task.IsRecurring = true
-	err := store.Add(task)
+	err := store.Add(context.Background(), task)
 	if err != nil {
 		t.Error("Failed to store task")
 	}
@@ -21,10 +23,10 @@ func TestStore(t *testing.T) {
 
 func TestStoreTaskWithMultipleParams(t *testing.T) {
 	mock := task.CallbackMock{}
-	funcRegistry := task.NewFuncRegistry()
-	store := getStoreBridge(funcRegistry, nil)
-	task := newTask(funcRegistry, mock.CallWithArgs, "Hello", "World")
-	err := store.Add(task)
+	stubs := mockStubs(mock.CallWithArgs)
+	store := getStoreBridge(stubs, nil)
+	task := newTask(mock.CallWithArgs, "Hello", "World")
+	err := store.Add(context.Background(), task)
 	if err != nil {
 		t.Error("Failed to store task with multiple params")
 	}
@@ -32,10 +34,10 @@ func TestStoreTaskWithMultipleParams(t *testing.T) {
 
 func TestStoreThatFails(t *testing.T) {
 	mock := task.CallbackMock{}
-	funcRegistry := task.NewFuncRegistry()
-	store := getStoreBridge(funcRegistry, nil)
-	task := newTask(funcRegistry, mock.CallWithChan, make(chan bool))
-	err := store.Add(task)
+	stubs := mockStubs(mock.CallWithChan)
+	store := getStoreBridge(stubs, nil)
+	task := newTask(mock.CallWithChan, make(chan bool))
+	err := store.Add(context.Background(), task)
 	if err == nil {
 		t.Error("Wrong storage of a task with a channel arg took place")
 	}
@@ -43,11 +45,11 @@ func TestStoreThatFails(t *testing.T) {
 
 func TestRemoveTask(t *testing.T) {
 	mock := task.CallbackMock{}
-	funcRegistry := task.NewFuncRegistry()
-	store := getStoreBridge(funcRegistry, nil)
-	task := newTask(funcRegistry, mock.CallWithArgs, "Hello", "World")
-	_ = store.Add(task)
-	err := store.Remove(task)
+	stubs := mockStubs(mock.CallWithArgs)
+	store := getStoreBridge(stubs, nil)
+	task := newTask(mock.CallWithArgs, "Hello", "World")
+	_ = store.Add(context.Background(), task)
+	err := store.Remove(context.Background(), task)
 	if err != nil {
 		t.Error("Failed to remove task")
 	}
@@ -55,10 +57,10 @@ func TestRemoveTask(t *testing.T) {
 
 func TestRemoveThatFails(t *testing.T) {
 	mock := task.CallbackMock{}
-	funcRegistry := task.NewFuncRegistry()
-	store := getStoreBridge(funcRegistry, nil)
-	task := newTask(funcRegistry, mock.CallWithChan, make(chan bool))
-	err := store.Remove(task)
+	stubs := mockStubs(mock.CallWithChan)
+	store := getStoreBridge(stubs, nil)
+	task := newTask(mock.CallWithChan, make(chan bool))
+	err := store.Remove(context.Background(), task)
 	if err == nil {
 		t.Error("Wrong call to remove a task with a channel arg took place")
 	}
@@ -66,14 +68,14 @@ func TestRemoveThatFails(t *testing.T) {
 
 func TestFetch(t *testing.T) {
 	mock := task.CallbackMock{}
-	funcRegistry := task.NewFuncRegistry()
-	store := getStoreBridge(funcRegistry, nil)
-	task := newTask(funcRegistry, mock.CallNoArgs)
-	err := store.Add(task)
+	stubs := mockStubs(mock.CallNoArgs)
+	store := getStoreBridge(stubs, nil)
+	task := newTask(mock.CallNoArgs)
+	err := store.Add(context.Background(), task)
 	if err != nil {
 		t.Error("Failed to store task")
 	}
-	tasks, err := store.Fetch()
+	tasks, err := store.Fetch(context.Background())
 	if err != nil {
 		t.Error("Could not read tasks from store")
 	}
@@ -85,14 +87,14 @@ func TestFetch(t *testing.T) {
 
 func TestFetchWithParams(t *testing.T) {
 	mock := task.CallbackMock{}
-	funcRegistry := task.NewFuncRegistry()
-	store := getStoreBridge(funcRegistry, nil)
-	task := newTask(funcRegistry, mock.CallWithArgs, "Test", true)
-	err := store.Add(task)
+	stubs := mockStubs(mock.CallWithArgs)
+	store := getStoreBridge(stubs, nil)
+	task := newTask(mock.CallWithArgs, "Test", true)
+	err := store.Add(context.Background(), task)
 	if err != nil {
 		t.Error("Failed to store task")
 	}
-	tasks, err := store.Fetch()
+	tasks, err := store.Fetch(context.Background())
 	if err != nil {
 		t.Error("Could not read tasks from store")
 	}
@@ -103,85 +105,81 @@ func TestFetchWithParams(t *testing.T) {
 }
 
 func TestFetchWrongRunTimes(t *testing.T) {
-	funcRegistry := task.NewFuncRegistry()
+	stubs := config.StubMapping{}
 
 	storeMock := newStoreMockWithMode(fail)
-	store := getStoreBridge(funcRegistry, storeMock)
-	_, err := store.Fetch()
+	store := getStoreBridge(stubs, storeMock)
+	_, err := store.Fetch(context.Background())
 	if err == nil {
 		t.Error("Should fail when fetching")
 	}
 
-	storeMock.Mode = failOnLastRun
-	_, err = store.Fetch()
-	if err == nil {
-		t.Error("Should fail when parsing lastRun")
-	}
-
-	storeMock.Mode = failOnNextRun
-	_, err = store.Fetch()
-	if err == nil {
-		t.Error("Should fail when parsing nextRun")
-	}
-
-	storeMock.Mode = failOnDuration
-	_, err = store.Fetch()
-	if err == nil {
-		t.Error("Should fail when parsing duration")
+	// Tasks which can't be loaded are skipped.
+	stubs[mockFunctionName] = mockFunction
+	for _, c := range []struct {
+		mode  storeMockMode
+		field string
+	}{
+		{failOnLastRun, "lastRun"},
+		{failOnNextRun, "nextRun"},
+		{failOnDuration, "duration"},
+		{failOnIsRecurring, "isRecurring"},
+		{failOnFuncMeta, "the function"},
+		{failOnEmptyParams, "empty string params"},
+		{failOnEmptyListParams, "empty list params"},
+	} {
+		storeMock.Mode = c.mode
+		tasks, err := store.Fetch(context.Background())
+		if err != nil || len(tasks) != 0 {
+			t.Errorf("Should skip a task with invalid %s, got %d tasks and error %v", c.field, len(tasks), err)
+		}
 	}
 
-	storeMock.Mode = failOnIsRecurring
-	_, err = store.Fetch()
-	if err == nil {
-		t.Error("Should fail when parsing isRecurring")
+	// lets close the underlying DB store.
+	if err := store.store.Close(); err != nil {
+		t.Error("Shouldn't fail when we close the DB store")
 	}
 
-	funcRegistry.Add(mockFunction)
-
-	storeMock.Mode = failOnFuncMeta
-	_, err = store.Fetch()
-	if err == nil {
-		t.Error("Should fail when trying to find function")
-	}
+}
 
-	storeMock.Mode = failOnEmptyParams
-	params, err := store.Fetch()
-	if err != nil && len(params) != 0 {
-		t.Error("Should fail when trying to parse empty string params")
+func TestFetchRekeysTasks(t *testing.T) {
+	mock := task.CallbackMock{}
+	memStore := storage.NewMemoryStorage()
+	store := getStoreBridge(mockStubs(mock.CallWithArgs), memStore)
+	task := newTask(mock.CallWithArgs, "Hello", true)
+	attributes, err := store.getTaskAttributes(task)
+	if err != nil {
+		t.Fatal("Failed to get task attributes: ", err)
 	}
+	attributes.Hash = "StaleHash"
+	_ = memStore.Add(context.Background(), attributes)
 
-	storeMock.Mode = failOnEmptyListParams
-	_, err = store.Fetch()
-	if err == nil {
-		t.Error("Should fail when trying to parse empty string params")
+	tasks, err := store.Fetch(context.Background())
+	if err != nil || len(tasks) != 1 {
+		t.Fatal("Could not read tasks from store: ", err)
 	}
-
-	// lets close the underlying DB store.
-	if err := store.store.Close(); err != nil {
-		t.Error("Shouldn't fail when we close the DB store")
+	if _, found := memStore.Get(string(task.Hash())); !found || memStore.Len() != 1 {
+		t.Errorf("The task should be stored under its ID only, found %+v", memStore.Snapshot())
 	}
-
 }
 
-func newTask(funcRegistry *task.FuncRegistry, function task.Function, params ...task.Param) *task.Task {
-	funcMeta, err := funcRegistry.Add(function)
+// newTask builds the task without validating the params, unlike the scheduler,
+// so that params which can't be stored reach the store bridge.
+func newTask(function task.Function, params ...task.Param) *task.Task {
+	funcMeta, err := task.Translate(function)
 	if err != nil {
 		return nil
 	}
-
-	task := task.New(funcMeta, params)
-	_, _ = funcRegistry.Add(task.Func)
-
-	return task
+	return task.New(funcMeta, params, *config.NewFunctionManager(mockStubs(function)))
 }
 
-func getStoreBridge(funcRegistry *task.FuncRegistry, store storage.TaskStore) storeBridge {
+func getStoreBridge(stubs config.StubMapping, store storage.ContextTaskStore) storeBridge {
 	if store == nil {
 		store = storage.NewMemoryStorage()
 	}
 	storeBridge := storeBridge{
-		store:        store,
-		funcRegistry: funcRegistry,
+		store:       store,
+		funcManager: *config.NewFunctionManager(stubs),
 	}
 	return storeBridge
 }
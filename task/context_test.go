@@ -0,0 +1,88 @@
+package task
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/config"
+)
+
+func TestTaskRunContextTimeout(t *testing.T) {
+	var ctxErr error
+	funcManager := config.NewFunctionManager(config.StubMapping{
+		"WaitForCancel": func(ctx context.Context, name string) {
+			<-ctx.Done()
+			ctxErr = ctx.Err()
+		},
+	})
+	task := New(FunctionMeta{Name: "WaitForCancel"}, []Param{"name"}, *funcManager)
+	task.Timeout = 10 * time.Millisecond
+
+	done := make(chan struct{})
+	go func() {
+		task.Run()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Task should have been interrupted by its timeout")
+	}
+	if ctxErr != context.DeadlineExceeded {
+		t.Error("Context should have expired, got: ", ctxErr)
+	}
+}
+
+func TestTaskRunContextCancel(t *testing.T) {
+	var received context.Context
+	funcManager := config.NewFunctionManager(config.StubMapping{
+		"ReceiveContext": func(ctx context.Context) {
+			received = ctx
+		},
+	})
+	task := New(FunctionMeta{Name: "ReceiveContext"}, nil, *funcManager)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	task.RunContext(ctx)
+	cancel()
+
+	if received == nil || received.Err() != context.Canceled {
+		t.Error("Function should receive the context passed to RunContext")
+	}
+}
+
+func TestTaskRunContextResults(t *testing.T) {
+	failure := errors.New("failed")
+	funcManager := config.NewFunctionManager(config.StubMapping{
+		"NoResult":       func() {},
+		"Value":          func() int { return 42 },
+		"ValueAndError":  func() (string, error) { return "partial", failure },
+		"OnlyNilError":   func() error { return nil },
+		"SeveralResults": func() (int, string, error) { return 1, "two", nil },
+	})
+	cases := []struct {
+		name   string
+		result interface{}
+		err    error
+	}{
+		{"NoResult", nil, nil},
+		{"Value", 42, nil},
+		{"ValueAndError", "partial", failure},
+		{"OnlyNilError", nil, nil},
+		{"SeveralResults", []interface{}{1, "two"}, nil},
+	}
+	for _, c := range cases {
+		task := New(FunctionMeta{Name: c.name}, nil, *funcManager)
+		result, err := task.RunContext(context.Background())
+		if !reflect.DeepEqual(result, c.result) {
+			t.Errorf("%s: expected result %v, got %v", c.name, c.result, result)
+		}
+		if err != c.err {
+			t.Errorf("%s: expected error %v, got %v", c.name, c.err, err)
+		}
+	}
+}
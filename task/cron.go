@@ -0,0 +1,295 @@
+package task
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CronSchedule is a parsed cron expression. Each field is stored as a bit set
+// where bit N is set when value N matches.
+type CronSchedule struct {
+	second, minute, hour, dom, month, dow uint64
+
+	// Standard cron semantics: when both day of month and day of week are
+	// restricted, a day matches if either of them matches.
+	domRestricted, dowRestricted bool
+}
+
+type cronBounds struct {
+	min, max int
+	names    map[string]int
+}
+
+var (
+	secondBounds = cronBounds{min: 0, max: 59}
+	minuteBounds = cronBounds{min: 0, max: 59}
+	hourBounds   = cronBounds{min: 0, max: 23}
+	domBounds    = cronBounds{min: 1, max: 31}
+	monthBounds  = cronBounds{min: 1, max: 12, names: map[string]int{
+		"jan": 1, "feb": 2, "mar": 3, "apr": 4, "may": 5, "jun": 6,
+		"jul": 7, "aug": 8, "sep": 9, "oct": 10, "nov": 11, "dec": 12,
+	}}
+	// Day of week accepts 7 as an alias for Sunday.
+	dowBounds = cronBounds{min: 0, max: 7, names: map[string]int{
+		"sun": 0, "mon": 1, "tue": 2, "wed": 3, "thu": 4, "fri": 5, "sat": 6,
+	}}
+)
+
+var cronMacros = map[string]string{
+	"@yearly":   "0 0 0 1 1 *",
+	"@annually": "0 0 0 1 1 *",
+	"@monthly":  "0 0 0 1 * *",
+	"@weekly":   "0 0 0 * * 0",
+	"@daily":    "0 0 0 * * *",
+	"@midnight": "0 0 0 * * *",
+	"@hourly":   "0 0 * * * *",
+}
+
+// ParseCron parses a standard 5-field cron expression (minute, hour, day of
+// month, month, day of week), a 6-field expression with a leading seconds field
+// or one of the @yearly, @annually, @monthly, @weekly, @daily, @midnight and
+// @hourly macros.
+func ParseCron(expr string) (*CronSchedule, error) {
+	spec := strings.TrimSpace(expr)
+	if strings.HasPrefix(spec, "@") {
+		macro, ok := cronMacros[strings.ToLower(spec)]
+		if !ok {
+			return nil, fmt.Errorf("Unknown cron macro %q", spec)
+		}
+		spec = macro
+	}
+
+	fields := strings.Fields(spec)
+	switch len(fields) {
+	case 5:
+		fields = append([]string{"0"}, fields...)
+	case 6:
+	default:
+		return nil, fmt.Errorf("Cron expression %q must have 5 or 6 fields, found %d", expr, len(fields))
+	}
+
+	var err error
+	schedule := &CronSchedule{}
+	if schedule.second, err = parseCronField(fields[0], secondBounds); err != nil {
+		return nil, fmt.Errorf("Invalid seconds in cron expression %q: %s", expr, err)
+	}
+	if schedule.minute, err = parseCronField(fields[1], minuteBounds); err != nil {
+		return nil, fmt.Errorf("Invalid minutes in cron expression %q: %s", expr, err)
+	}
+	if schedule.hour, err = parseCronField(fields[2], hourBounds); err != nil {
+		return nil, fmt.Errorf("Invalid hours in cron expression %q: %s", expr, err)
+	}
+	if schedule.dom, err = parseCronField(fields[3], domBounds); err != nil {
+		return nil, fmt.Errorf("Invalid day of month in cron expression %q: %s", expr, err)
+	}
+	if schedule.month, err = parseCronField(fields[4], monthBounds); err != nil {
+		return nil, fmt.Errorf("Invalid month in cron expression %q: %s", expr, err)
+	}
+	if schedule.dow, err = parseCronField(fields[5], dowBounds); err != nil {
+		return nil, fmt.Errorf("Invalid day of week in cron expression %q: %s", expr, err)
+	}
+	if schedule.dow&(1<<7) != 0 {
+		schedule.dow |= 1
+	}
+	schedule.domRestricted = !isCronWildcard(fields[3])
+	schedule.dowRestricted = !isCronWildcard(fields[5])
+	return schedule, nil
+}
+
+// Next returns the first time matching the schedule which is strictly after t.
+// The schedule is evaluated against the wall clock of t's location, see
+// wallClock for how DST transitions are handled. A zero time is returned when
+// no matching time exists within the next five years (e.g. "0 0 30 2 *").
+func (schedule *CronSchedule) Next(t time.Time) time.Time {
+	loc := t.Location()
+
+	// Search over wall-clock times, using UTC as a calendar without
+	// transitions, and map each match back onto loc.
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	for {
+		wall = schedule.nextWallClock(wall.Add(time.Second))
+		if wall.IsZero() {
+			return time.Time{}
+		}
+		next := wallClock(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), loc)
+		// A wall-clock time repeated by a DST transition resolves to its first
+		// occurrence, which may already have passed.
+		if next.After(t) {
+			return next
+		}
+	}
+}
+
+// Prev returns the last time matching the schedule which isn't after t. Like Next,
+// the schedule is evaluated against the wall clock of t's location, and a zero time
+// is returned when no matching time exists within the previous five years.
+func (schedule *CronSchedule) Prev(t time.Time) time.Time {
+	loc := t.Location()
+
+	wall := time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+	for {
+		wall = schedule.prevWallClock(wall)
+		if wall.IsZero() {
+			return time.Time{}
+		}
+		prev := wallClock(wall.Year(), wall.Month(), wall.Day(), wall.Hour(), wall.Minute(), wall.Second(), loc)
+		// A wall-clock time skipped by a DST transition resolves to a later time,
+		// which may be after t.
+		if !prev.After(t) {
+			return prev
+		}
+		wall = wall.Add(-time.Second)
+	}
+}
+
+// nextWallClock returns the first wall-clock time matching the schedule at or
+// after wall, which must be in UTC.
+func (schedule *CronSchedule) nextWallClock(wall time.Time) time.Time {
+	yearLimit := wall.Year() + 5
+
+	for wall.Year() <= yearLimit {
+		if !schedule.has(schedule.month, int(wall.Month())) {
+			wall = time.Date(wall.Year(), wall.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !schedule.dayMatches(wall) {
+			wall = time.Date(wall.Year(), wall.Month(), wall.Day()+1, 0, 0, 0, 0, time.UTC)
+			continue
+		}
+		if !schedule.has(schedule.hour, wall.Hour()) {
+			wall = wall.Truncate(time.Hour).Add(time.Hour)
+			continue
+		}
+		if !schedule.has(schedule.minute, wall.Minute()) {
+			wall = wall.Truncate(time.Minute).Add(time.Minute)
+			continue
+		}
+		if !schedule.has(schedule.second, wall.Second()) {
+			wall = wall.Add(time.Second)
+			continue
+		}
+		return wall
+	}
+	return time.Time{}
+}
+
+// prevWallClock returns the last wall-clock time matching the schedule at or
+// before wall, which must be in UTC.
+func (schedule *CronSchedule) prevWallClock(wall time.Time) time.Time {
+	yearLimit := wall.Year() - 5
+
+	for wall.Year() >= yearLimit {
+		if !schedule.has(schedule.month, int(wall.Month())) {
+			wall = time.Date(wall.Year(), wall.Month(), 1, 0, 0, 0, 0, time.UTC).Add(-time.Second)
+			continue
+		}
+		if !schedule.dayMatches(wall) {
+			wall = time.Date(wall.Year(), wall.Month(), wall.Day(), 0, 0, 0, 0, time.UTC).Add(-time.Second)
+			continue
+		}
+		if !schedule.has(schedule.hour, wall.Hour()) {
+			wall = wall.Truncate(time.Hour).Add(-time.Second)
+			continue
+		}
+		if !schedule.has(schedule.minute, wall.Minute()) {
+			wall = wall.Truncate(time.Minute).Add(-time.Second)
+			continue
+		}
+		if !schedule.has(schedule.second, wall.Second()) {
+			wall = wall.Add(-time.Second)
+			continue
+		}
+		return wall
+	}
+	return time.Time{}
+}
+
+func (schedule *CronSchedule) has(field uint64, value int) bool {
+	return field&(1<<uint(value)) != 0
+}
+
+func (schedule *CronSchedule) dayMatches(t time.Time) bool {
+	domMatch := schedule.has(schedule.dom, t.Day())
+	dowMatch := schedule.has(schedule.dow, int(t.Weekday()))
+	if schedule.domRestricted && schedule.dowRestricted {
+		return domMatch || dowMatch
+	}
+	return domMatch && dowMatch
+}
+
+func isCronWildcard(field string) bool {
+	return field == "*" || field == "?"
+}
+
+func parseCronField(field string, bounds cronBounds) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		partBits, err := parseCronRange(part, bounds)
+		if err != nil {
+			return 0, err
+		}
+		bits |= partBits
+	}
+	return bits, nil
+}
+
+func parseCronRange(part string, bounds cronBounds) (uint64, error) {
+	rangeAndStep := strings.Split(part, "/")
+	if len(rangeAndStep) > 2 {
+		return 0, fmt.Errorf("too many slashes in %q", part)
+	}
+
+	start, end := bounds.min, bounds.max
+	step := 1
+	if rangeAndStep[0] != "*" && rangeAndStep[0] != "?" {
+		lowAndHigh := strings.Split(rangeAndStep[0], "-")
+		if len(lowAndHigh) > 2 {
+			return 0, fmt.Errorf("too many hyphens in %q", part)
+		}
+		var err error
+		if start, err = parseCronValue(lowAndHigh[0], bounds); err != nil {
+			return 0, err
+		}
+		switch {
+		case len(lowAndHigh) == 2:
+			if end, err = parseCronValue(lowAndHigh[1], bounds); err != nil {
+				return 0, err
+			}
+		case len(rangeAndStep) == 1:
+			// A single value, e.g. "5".
+			end = start
+		}
+	}
+	if len(rangeAndStep) == 2 {
+		var err error
+		step, err = strconv.Atoi(rangeAndStep[1])
+		if err != nil || step <= 0 {
+			return 0, fmt.Errorf("invalid step in %q", part)
+		}
+	}
+	if start > end {
+		return 0, fmt.Errorf("range start is beyond range end in %q", part)
+	}
+
+	var bits uint64
+	for value := start; value <= end; value += step {
+		bits |= 1 << uint(value)
+	}
+	return bits, nil
+}
+
+func parseCronValue(value string, bounds cronBounds) (int, error) {
+	if number, ok := bounds.names[strings.ToLower(value)]; ok {
+		return number, nil
+	}
+	number, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value %q", value)
+	}
+	if number < bounds.min || number > bounds.max {
+		return 0, fmt.Errorf("value %d out of range [%d, %d]", number, bounds.min, bounds.max)
+	}
+	return number, nil
+}
@@ -0,0 +1,143 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/config"
+)
+
+func TestParseCron(t *testing.T) {
+	valid := []string{
+		"* * * * *",
+		"*/5 * * * *",
+		"0 9 * * mon-fri",
+		"30 0 9 1,15 * ?",
+		"0 0 1 jan,jul *",
+		"0 0 * * 7",
+		"@daily",
+		"@Hourly",
+		"@yearly",
+	}
+	for _, expr := range valid {
+		if _, err := ParseCron(expr); err != nil {
+			t.Errorf("%q should parse: %s", expr, err)
+		}
+	}
+
+	invalid := []string{
+		"",
+		"* * * *",
+		"* * * * * * *",
+		"60 * * * *",
+		"* 24 * * *",
+		"* * 0 * *",
+		"* * * 13 *",
+		"* * * * 8",
+		"5-1 * * * *",
+		"*/0 * * * *",
+		"1-2-3 * * * *",
+		"foo * * * *",
+		"@fortnightly",
+	}
+	for _, expr := range invalid {
+		if _, err := ParseCron(expr); err == nil {
+			t.Errorf("%q should not parse", expr)
+		}
+	}
+}
+
+func TestCronNext(t *testing.T) {
+	from := time.Date(2021, time.March, 10, 12, 34, 56, 0, time.UTC) // A Wednesday
+	cases := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2021, time.March, 10, 12, 35, 0, 0, time.UTC)},
+		{"* * * * * *", time.Date(2021, time.March, 10, 12, 34, 57, 0, time.UTC)},
+		{"*/15 * * * *", time.Date(2021, time.March, 10, 12, 45, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2021, time.March, 11, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon", time.Date(2021, time.March, 15, 9, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2021, time.March, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2022, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2024, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		// Day of month and day of week are OR-ed when both are restricted.
+		{"0 0 20 * fri", time.Date(2021, time.March, 12, 0, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2021, time.March, 10, 13, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2021, time.March, 14, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		cron, err := ParseCron(c.expr)
+		if err != nil {
+			t.Fatalf("%q should parse: %s", c.expr, err)
+		}
+		if next := cron.Next(from); !next.Equal(c.expected) {
+			t.Errorf("%q: expected next run %s, got %s", c.expr, c.expected, next)
+		}
+	}
+}
+
+func TestTaskScheduleNextRunCron(t *testing.T) {
+	nextRun := time.Date(2021, time.March, 10, 9, 0, 0, 0, time.UTC)
+	task := NewWithSchedule(FunctionMeta{Name: "CronTask"}, nil, Schedule{
+		IsRecurring: true,
+		NextRun:     nextRun,
+		CronExpr:    "0 9 * * *",
+	}, config.FunctionManager{})
+	task.ScheduleNextRun()
+
+	if !task.LastRun.Equal(nextRun) {
+		t.Error("LastRun should be the previous NextRun")
+	}
+	if !task.NextRun.Equal(nextRun.AddDate(0, 0, 1)) {
+		t.Errorf("NextRun should be the following day, got %s", task.NextRun)
+	}
+}
+
+func TestTaskScheduleNextRunEnds(t *testing.T) {
+	nextRun := time.Date(2021, time.March, 10, 9, 0, 0, 0, time.UTC)
+	for _, schedule := range []Schedule{
+		{CronExpr: "0 0 30 2 *"},
+		{CronExpr: "invalid"},
+		{Duration: 0},
+	} {
+		schedule.IsRecurring = true
+		schedule.NextRun = nextRun
+		task := NewWithSchedule(FunctionMeta{Name: "EndingTask"}, nil, schedule, config.FunctionManager{})
+		task.ScheduleNextRun()
+
+		if !task.Ended() {
+			t.Errorf("The schedule %+v should have ended, got next run %s", schedule, task.NextRun)
+		}
+	}
+}
+
+func TestCronPrev(t *testing.T) {
+	until := time.Date(2021, time.March, 10, 12, 34, 56, 0, time.UTC) // A Wednesday
+	cases := []struct {
+		expr     string
+		expected time.Time
+	}{
+		{"* * * * *", time.Date(2021, time.March, 10, 12, 34, 0, 0, time.UTC)},
+		{"* * * * * *", until},
+		{"*/15 * * * *", time.Date(2021, time.March, 10, 12, 30, 0, 0, time.UTC)},
+		{"0 9 * * *", time.Date(2021, time.March, 10, 9, 0, 0, 0, time.UTC)},
+		{"0 9 * * mon", time.Date(2021, time.March, 8, 9, 0, 0, 0, time.UTC)},
+		{"0 0 31 * *", time.Date(2021, time.January, 31, 0, 0, 0, 0, time.UTC)},
+		{"0 0 1 1 *", time.Date(2021, time.January, 1, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC)},
+		{"0 0 20 * fri", time.Date(2021, time.March, 5, 0, 0, 0, 0, time.UTC)},
+		{"@weekly", time.Date(2021, time.March, 7, 0, 0, 0, 0, time.UTC)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+	for _, c := range cases {
+		cron, err := ParseCron(c.expr)
+		if err != nil {
+			t.Fatalf("%q should parse: %s", c.expr, err)
+		}
+		if prev := cron.Prev(until); !prev.Equal(c.expected) {
+			t.Errorf("%q: expected previous run %s, got %s", c.expr, c.expected, prev)
+		}
+	}
+}
@@ -0,0 +1,45 @@
+package task
+
+import "time"
+
+// wallClock returns the instant at which a clock in loc shows the given date and
+// time. Unlike time.Date, the result is well defined around DST transitions:
+//   - A wall-clock time skipped when clocks spring forward resolves to the
+//     instant the same distance after the transition (02:30 becomes 03:30 when
+//     clocks jump from 02:00 to 03:00).
+//   - A wall-clock time repeated when clocks fall back resolves to its first
+//     occurrence.
+func wallClock(year int, month time.Month, day, hour, min, sec int, loc *time.Location) time.Time {
+	naive := time.Date(year, month, day, hour, min, sec, 0, time.UTC)
+
+	// A zone offset never exceeds 14 hours, so the offsets in effect one day
+	// before and one day after are the only ones that can apply to naive.
+	_, offsetBefore := naive.Add(-24 * time.Hour).In(loc).Zone()
+	_, offsetAfter := naive.Add(24 * time.Hour).In(loc).Zone()
+	before := naive.Add(-time.Duration(offsetBefore) * time.Second).In(loc)
+	after := naive.Add(-time.Duration(offsetAfter) * time.Second).In(loc)
+
+	beforeValid := sameWallClock(before, naive)
+	afterValid := sameWallClock(after, naive)
+	switch {
+	case beforeValid && afterValid:
+		if after.Before(before) {
+			return after
+		}
+		return before
+	case afterValid:
+		return after
+	default:
+		// Either before is the only valid candidate or the wall-clock time was
+		// skipped, in which case the offset from before the gap moves it past
+		// the transition.
+		return before
+	}
+}
+
+func sameWallClock(t time.Time, naive time.Time) bool {
+	year, month, day := t.Date()
+	nYear, nMonth, nDay := naive.Date()
+	return year == nYear && month == nMonth && day == nDay &&
+		t.Hour() == naive.Hour() && t.Minute() == naive.Minute() && t.Second() == naive.Second()
+}
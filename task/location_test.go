@@ -0,0 +1,156 @@
+package task
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata"
+
+	"github.com/ClubNFT/scheduler/config"
+)
+
+func loadBerlin(t *testing.T) *time.Location {
+	berlin, err := time.LoadLocation("Europe/Berlin")
+	if err != nil {
+		t.Fatal("Failed to load location: ", err)
+	}
+	return berlin
+}
+
+func TestWallClock(t *testing.T) {
+	berlin := loadBerlin(t)
+
+	regular := wallClock(2021, time.June, 1, 9, 0, 0, berlin)
+	if !regular.Equal(time.Date(2021, time.June, 1, 7, 0, 0, 0, time.UTC)) {
+		t.Error("Regular wall-clock time resolved incorrectly: ", regular)
+	}
+
+	// Clocks jumped from 02:00 CET to 03:00 CEST on 2021-03-28.
+	skipped := wallClock(2021, time.March, 28, 2, 30, 0, berlin)
+	if !skipped.Equal(time.Date(2021, time.March, 28, 1, 30, 0, 0, time.UTC)) {
+		t.Error("Skipped wall-clock time should move past the gap: ", skipped)
+	}
+
+	// Clocks went back from 03:00 CEST to 02:00 CET on 2021-10-31.
+	repeated := wallClock(2021, time.October, 31, 2, 30, 0, berlin)
+	if !repeated.Equal(time.Date(2021, time.October, 31, 0, 30, 0, 0, time.UTC)) {
+		t.Error("Repeated wall-clock time should resolve to its first occurrence: ", repeated)
+	}
+}
+
+func TestCronNextAcrossDST(t *testing.T) {
+	berlin := loadBerlin(t)
+
+	daily, _ := ParseCron("0 9 * * *")
+	next := daily.Next(time.Date(2021, time.March, 27, 9, 0, 0, 0, berlin))
+	if next.Hour() != 9 || next.Day() != 28 {
+		t.Error("Daily task should keep its wall-clock time across spring forward: ", next)
+	}
+	next = daily.Next(time.Date(2021, time.October, 30, 9, 0, 0, 0, berlin))
+	if next.Hour() != 9 || next.Day() != 31 {
+		t.Error("Daily task should keep its wall-clock time across fall back: ", next)
+	}
+
+	// A task in the skipped hour runs once, right after the gap.
+	skipped, _ := ParseCron("30 2 * * *")
+	next = skipped.Next(time.Date(2021, time.March, 27, 2, 30, 0, 0, berlin))
+	if !next.Equal(time.Date(2021, time.March, 28, 3, 30, 0, 0, berlin)) {
+		t.Error("Skipped run should happen after the gap: ", next)
+	}
+	next = skipped.Next(next)
+	if !next.Equal(time.Date(2021, time.March, 29, 2, 30, 0, 0, berlin)) {
+		t.Error("Run after the gap should return to the original wall-clock time: ", next)
+	}
+
+	// A task in the repeated hour runs only once.
+	repeated, _ := ParseCron("30 2 * * *")
+	first := repeated.Next(time.Date(2021, time.October, 31, 0, 0, 0, 0, berlin))
+	if !first.Equal(time.Date(2021, time.October, 31, 0, 30, 0, 0, time.UTC)) {
+		t.Error("Repeated run should happen at its first occurrence: ", first)
+	}
+	next = repeated.Next(first)
+	if !next.Equal(time.Date(2021, time.November, 1, 2, 30, 0, 0, berlin)) {
+		t.Error("Repeated run should not happen twice: ", next)
+	}
+}
+
+func TestCronPrevAcrossDST(t *testing.T) {
+	berlin := loadBerlin(t)
+
+	// The skipped run happens after the gap, it's only the previous run once that passed.
+	skipped, _ := ParseCron("30 2 * * *")
+	prev := skipped.Prev(time.Date(2021, time.March, 28, 3, 0, 0, 0, berlin))
+	if !prev.Equal(time.Date(2021, time.March, 27, 2, 30, 0, 0, berlin)) {
+		t.Error("Skipped run should not be the previous run before the gap ended: ", prev)
+	}
+	prev = skipped.Prev(time.Date(2021, time.March, 28, 4, 0, 0, 0, berlin))
+	if !prev.Equal(time.Date(2021, time.March, 28, 3, 30, 0, 0, berlin)) {
+		t.Error("Skipped run should happen after the gap: ", prev)
+	}
+
+	// A task in the repeated hour ran at its first occurrence.
+	repeated, _ := ParseCron("30 2 * * *")
+	prev = repeated.Prev(time.Date(2021, time.October, 31, 4, 0, 0, 0, berlin))
+	if !prev.Equal(time.Date(2021, time.October, 31, 0, 30, 0, 0, time.UTC)) {
+		t.Error("Repeated run should happen at its first occurrence: ", prev)
+	}
+}
+
+func TestScheduleNextRunWithLocation(t *testing.T) {
+	berlin := loadBerlin(t)
+	nextRun := time.Date(2021, time.March, 27, 9, 0, 0, 0, berlin)
+	task := NewWithSchedule(FunctionMeta{Name: "DailyTask"}, nil, Schedule{
+		IsRecurring: true,
+		NextRun:     nextRun,
+		Duration:    24 * time.Hour,
+		Location:    berlin,
+	}, config.FunctionManager{})
+	task.ScheduleNextRun()
+
+	if !task.NextRun.Equal(time.Date(2021, time.March, 28, 9, 0, 0, 0, berlin)) {
+		t.Error("Interval task should keep its wall-clock time across DST: ", task.NextRun)
+	}
+	if elapsed := task.NextRun.Sub(task.LastRun); elapsed != 23*time.Hour {
+		t.Error("The DST change day should only be 23 hours long, got ", elapsed)
+	}
+
+	task.Location = nil
+	task.ScheduleNextRun()
+	if task.NextRun.Sub(task.LastRun) != 24*time.Hour {
+		t.Error("Interval task without location should use elapsed time")
+	}
+}
+
+func TestScheduleNextRunAfterSkippedHour(t *testing.T) {
+	berlin := loadBerlin(t)
+	firstRun := time.Date(2021, time.March, 26, 2, 30, 0, 0, berlin)
+	task := NewWithSchedule(FunctionMeta{Name: "DailyTask"}, nil, Schedule{
+		IsRecurring: true,
+		NextRun:     firstRun,
+		FirstRun:    firstRun,
+		Duration:    24 * time.Hour,
+		Location:    berlin,
+	}, config.FunctionManager{})
+
+	// Clocks jumped from 02:00 CET to 03:00 CEST on 2021-03-28.
+	expected := []time.Time{
+		time.Date(2021, time.March, 27, 2, 30, 0, 0, berlin),
+		time.Date(2021, time.March, 28, 3, 30, 0, 0, berlin),
+		time.Date(2021, time.March, 29, 2, 30, 0, 0, berlin),
+		time.Date(2021, time.March, 30, 2, 30, 0, 0, berlin),
+	}
+	for _, nextRun := range expected {
+		task.ScheduleNextRun()
+		if !task.NextRun.Equal(nextRun) {
+			t.Fatalf("Expected the next run at %s, got %s", nextRun, task.NextRun)
+		}
+	}
+
+	// A remainder is added as elapsed time to every run after the first one.
+	task.Duration = 36 * time.Hour
+	task.NextRun = firstRun
+	task.ScheduleNextRun()
+	task.ScheduleNextRun()
+	if !task.NextRun.Equal(time.Date(2021, time.March, 29, 2, 30, 0, 0, berlin)) {
+		t.Error("Intervals with a remainder should not drift either, got ", task.NextRun)
+	}
+}
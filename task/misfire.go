@@ -0,0 +1,105 @@
+package task
+
+import (
+	"time"
+)
+
+// MisfireMode selects how the runs of a task are handled which were missed, e.g.
+// while no scheduler was running.
+type MisfireMode int
+
+const (
+	// MisfireFireOnce runs the task once for all of its missed runs and continues with
+	// its next run after now.
+	MisfireFireOnce MisfireMode = iota
+	// MisfireFireAll runs the task once for every missed run, one after the other.
+	MisfireFireAll
+	// MisfireSkip drops all missed runs.
+	MisfireSkip
+	// MisfireGraceTime runs the task for every missed run which is late by at most
+	// the policy's GraceTime and drops the earlier ones.
+	MisfireGraceTime
+)
+
+// MisfireTolerance is how late a run may start before it counts as missed.
+const MisfireTolerance = time.Second
+
+// MisfirePolicy describes how missed runs of a task are handled. The zero value runs
+// the task once for all of them.
+type MisfirePolicy struct {
+	Mode MisfireMode
+	// GraceTime is how late a run may be with MisfireGraceTime.
+	GraceTime time.Duration
+}
+
+// HandleMisfire drops the missed runs of a task which is due at now according to its
+// misfire policy, moving NextRun to the first run which is kept. It reports whether
+// the task is still due, one-off tasks whose run was dropped are not, and neither are
+// recurring tasks whose schedule ended.
+func (task *Task) HandleMisfire(now time.Time) bool {
+	var keepFrom time.Time
+	switch task.Misfire.Mode {
+	case MisfireFireAll:
+		return true
+	case MisfireSkip:
+		keepFrom = now.Add(-MisfireTolerance)
+	case MisfireGraceTime:
+		keepFrom = now.Add(-task.Misfire.GraceTime)
+	default:
+		// Only the latest missed run is kept.
+		if task.IsRecurring {
+			task.NextRun = task.Schedule.latest(task.NextRun, now)
+		}
+		return true
+	}
+
+	if !task.NextRun.Before(keepFrom) {
+		return true
+	}
+	if !task.IsRecurring {
+		return false
+	}
+	task.NextRun = task.Schedule.next(task.Schedule.latest(task.NextRun, keepFrom))
+	return !task.Ended() && !task.NextRun.After(now)
+}
+
+// latest returns the last occurrence of a recurring schedule which isn't after until,
+// counting from the occurrence at from. It's computed at once rather than stepping
+// through the occurrences, which may be many after a long downtime.
+func (schedule Schedule) latest(from, until time.Time) time.Time {
+	if !until.After(from) {
+		return from
+	}
+	var latest time.Time
+	switch {
+	case schedule.CronExpr != "":
+		cron, err := ParseCron(schedule.CronExpr)
+		if err != nil {
+			// The schedule ends with its next run, see next.
+			return from
+		}
+		loc := from.Location()
+		if schedule.Location != nil {
+			loc = schedule.Location
+		}
+		latest = cron.Prev(until.In(loc))
+	case schedule.Duration <= 0:
+		return from
+	case schedule.Location == nil || schedule.Duration < 24*time.Hour:
+		// Fixed intervals are skipped at once.
+		return from.Add(until.Sub(from) / schedule.Duration * schedule.Duration)
+	default:
+		// DST changes shift occurrences by a few hours at most, so the occurrence
+		// after the estimated one is after until unless it's the latest one.
+		first := schedule.firstOccurrence(from.In(schedule.Location))
+		n := int(until.Sub(first)/schedule.Duration) + 1
+		for n > 0 && schedule.occurrence(first, n).After(until) {
+			n--
+		}
+		latest = schedule.occurrence(first, n)
+	}
+	if !latest.After(from) {
+		return from
+	}
+	return latest
+}
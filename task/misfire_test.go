@@ -0,0 +1,109 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/config"
+)
+
+func TestHandleMisfire(t *testing.T) {
+	now := time.Date(2017, 11, 11, 12, 0, 30, 0, time.UTC)
+	missedSince := time.Date(2017, 11, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name      string
+		policy    MisfirePolicy
+		recurring bool
+		due       bool
+		nextRun   time.Time
+	}{
+		{"fire once", MisfirePolicy{}, true, true, now.Add(-30 * time.Second)},
+		{"fire all", MisfirePolicy{Mode: MisfireFireAll}, true, true, missedSince},
+		{"skip", MisfirePolicy{Mode: MisfireSkip}, true, false, now.Add(30 * time.Second)},
+		{"grace time", MisfirePolicy{Mode: MisfireGraceTime, GraceTime: 5 * time.Minute}, true, true,
+			now.Add(-4*time.Minute - 30*time.Second)},
+		{"one-off fire once", MisfirePolicy{}, false, true, missedSince},
+		{"one-off skip", MisfirePolicy{Mode: MisfireSkip}, false, false, missedSince},
+		{"one-off grace time", MisfirePolicy{Mode: MisfireGraceTime, GraceTime: 48 * time.Hour}, false, true,
+			missedSince},
+	}
+	for _, test := range tests {
+		task := New(FunctionMeta{Name: "Missed"}, nil, config.FunctionManager{})
+		task.IsRecurring = test.recurring
+		task.Duration = time.Minute
+		task.NextRun = missedSince
+		task.Misfire = test.policy
+
+		if due := task.HandleMisfire(now); due != test.due {
+			t.Errorf("%s: expected due %t, got %t", test.name, test.due, due)
+		}
+		if !task.NextRun.Equal(test.nextRun) {
+			t.Errorf("%s: expected next run at %s, got %s", test.name, test.nextRun, task.NextRun)
+		}
+	}
+}
+
+func TestHandleMisfireOnTime(t *testing.T) {
+	now := time.Now()
+	task := New(FunctionMeta{Name: "OnTime"}, nil, config.FunctionManager{})
+	task.NextRun = now.Add(-MisfireTolerance / 2)
+	task.Misfire = MisfirePolicy{Mode: MisfireSkip}
+	if !task.HandleMisfire(now) {
+		t.Error("A run which is late by less than the tolerance should not be dropped")
+	}
+}
+
+func TestHandleMisfireCron(t *testing.T) {
+	now := time.Date(2017, 11, 11, 12, 7, 0, 0, time.UTC)
+	task := New(FunctionMeta{Name: "Cron"}, nil, config.FunctionManager{})
+	task.IsRecurring = true
+	task.CronExpr = "*/5 * * * *"
+	task.NextRun = time.Date(2017, 11, 10, 12, 0, 0, 0, time.UTC)
+
+	if !task.HandleMisfire(now) {
+		t.Error("The latest missed run should be due")
+	}
+	if expected := time.Date(2017, 11, 11, 12, 5, 0, 0, time.UTC); !task.NextRun.Equal(expected) {
+		t.Errorf("Expected next run at %s, got %s", expected, task.NextRun)
+	}
+}
+
+func TestScheduleLatest(t *testing.T) {
+	berlin := loadBerlin(t)
+	from := time.Date(2021, time.March, 20, 9, 0, 0, 0, berlin)
+	until := time.Date(2021, time.November, 5, 12, 0, 0, 0, berlin)
+	schedules := []Schedule{
+		{IsRecurring: true, Duration: time.Hour},
+		{IsRecurring: true, Duration: 24 * time.Hour, Location: berlin},
+		{IsRecurring: true, Duration: 36 * time.Hour, Location: berlin, FirstRun: from},
+		{IsRecurring: true, CronExpr: "15 * * * *"},
+		{IsRecurring: true, CronExpr: "30 2 * * *", Location: berlin},
+		{IsRecurring: true, CronExpr: "0 0 30 2 *"},
+	}
+	for _, schedule := range schedules {
+		// The latest occurrence is the one reached by stepping through all of them.
+		expected := from
+		for next := schedule.next(from); !next.IsZero() && !next.After(until); next = schedule.next(next) {
+			expected = next
+		}
+		if latest := schedule.latest(from, until); !latest.Equal(expected) {
+			t.Errorf("%+v: expected the latest run at %s, got %s", schedule, expected, latest)
+		}
+	}
+}
+
+func TestHandleMisfireAfterLongDowntime(t *testing.T) {
+	now := time.Date(2017, 12, 10, 12, 0, 30, 0, time.UTC)
+	task := New(FunctionMeta{Name: "Cron"}, nil, config.FunctionManager{})
+	task.IsRecurring = true
+	task.CronExpr = "* * * * * *"
+	task.NextRun = now.Add(-30 * 24 * time.Hour)
+
+	started := time.Now()
+	if !task.HandleMisfire(now) || !task.NextRun.Equal(now) {
+		t.Errorf("The latest missed run should be due at %s, got %s", now, task.NextRun)
+	}
+	if elapsed := time.Since(started); elapsed > 100*time.Millisecond {
+		t.Errorf("The missed runs should be skipped at once, took %s", elapsed)
+	}
+}
@@ -0,0 +1,15 @@
+package task
+
+// OverlapPolicy selects what happens when a run of a task is due while a previous run
+// of it is still in progress.
+type OverlapPolicy int
+
+const (
+	// OverlapAllow starts the due run alongside the one in progress.
+	OverlapAllow OverlapPolicy = iota
+	// OverlapSkip drops the due run.
+	OverlapSkip
+	// OverlapQueue starts the due run right after the one in progress finished. At most
+	// one run is queued, runs which are due while one is queued are dropped.
+	OverlapQueue
+)
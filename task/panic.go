@@ -0,0 +1,14 @@
+package task
+
+import "fmt"
+
+// PanicError is returned for an execution whose function panicked. It holds
+// the value passed to panic and the stack trace of the panicking goroutine.
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (err *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v\n\n%s", err.Value, err.Stack)
+}
@@ -0,0 +1,63 @@
+package task
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/ClubNFT/scheduler/config"
+)
+
+func panickingFunction() {
+	panic("boom")
+}
+
+func TestTaskRunRecoversPanic(t *testing.T) {
+	funcManager := config.NewFunctionManager(config.StubMapping{
+		"Panic": panickingFunction,
+	})
+	task := New(FunctionMeta{Name: "Panic"}, nil, *funcManager)
+
+	_, err := task.RunContext(context.Background())
+	panicErr, ok := err.(*PanicError)
+	if !ok {
+		t.Fatal("A panic should be returned as a PanicError, got: ", err)
+	}
+	if panicErr.Value != "boom" {
+		t.Error("PanicError should hold the panic value, got: ", panicErr.Value)
+	}
+	if !strings.Contains(string(panicErr.Stack), "panickingFunction") {
+		t.Error("PanicError should hold the stack trace of the panic")
+	}
+}
+
+func TestTaskRunUnregisteredFunction(t *testing.T) {
+	funcManager := config.NewFunctionManager(config.StubMapping{
+		"Nil": nil,
+	})
+	for _, name := range []string{"Nil", "Unregistered"} {
+		task := New(FunctionMeta{Name: name}, nil, *funcManager)
+		_, err := task.RunContext(context.Background())
+		if err == nil {
+			t.Errorf("Running %s should fail", name)
+		}
+		if _, ok := err.(*PanicError); ok {
+			t.Errorf("Running %s should fail without panicking", name)
+		}
+	}
+}
+
+func TestTaskRunWrongParamType(t *testing.T) {
+	funcManager := config.NewFunctionManager(config.StubMapping{
+		"TakesInt": func(int) {},
+	})
+	task := New(FunctionMeta{Name: "TakesInt"}, []Param{"1"}, *funcManager)
+	if _, err := task.RunContext(context.Background()); !isPanic(err) {
+		t.Error("Calling a function with a mismatching param should be recovered")
+	}
+}
+
+func isPanic(err error) bool {
+	_, ok := err.(*PanicError)
+	return ok
+}
@@ -0,0 +1,69 @@
+package task
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Param is a parameter passed to the function of a task. Params are persisted
+// as JSON, so their types need to support encoding/json.
+type Param interface{}
+
+// ValidateParams checks that params can be passed to a function whose
+// parameters have the given types. The variadic params of a variadic function
+// are passed together as a slice.
+func ValidateParams(params []Param, types []reflect.Type) error {
+	if len(params) != len(types) {
+		return fmt.Errorf("Function expects %d params, got %d", len(types), len(params))
+	}
+	for i, param := range params {
+		if param == nil {
+			switch types[i].Kind() {
+			case reflect.Interface, reflect.Ptr, reflect.Slice, reflect.Map:
+				continue
+			}
+			return fmt.Errorf("Param %d can't be nil, expected %s", i, types[i])
+		}
+		if paramType := reflect.TypeOf(param); !paramType.AssignableTo(types[i]) {
+			return fmt.Errorf("Param %d has type %s, expected %s", i, paramType, types[i])
+		}
+	}
+	return nil
+}
+
+// EncodeParams returns the JSON representation of the task's params.
+func (task *Task) EncodeParams() (string, error) {
+	if len(task.Params) == 0 {
+		return "[]", nil
+	}
+	encoded, err := json.Marshal(task.Params)
+	if err != nil {
+		return "", fmt.Errorf("Params can't be encoded as JSON: %s", err)
+	}
+	return string(encoded), nil
+}
+
+// DecodeParams decodes the JSON representation of params into values of the
+// given types, so that they can be passed to the function they belong to.
+func DecodeParams(encoded string, types []reflect.Type) ([]Param, error) {
+	var rawParams []json.RawMessage
+	if encoded != "" {
+		if err := json.Unmarshal([]byte(encoded), &rawParams); err != nil {
+			return nil, fmt.Errorf("Params can't be decoded: %s", err)
+		}
+	}
+	if len(rawParams) != len(types) {
+		return nil, fmt.Errorf("Function expects %d params, found %d", len(types), len(rawParams))
+	}
+
+	params := make([]Param, len(rawParams))
+	for i, rawParam := range rawParams {
+		value := reflect.New(types[i])
+		if err := json.Unmarshal(rawParam, value.Interface()); err != nil {
+			return nil, fmt.Errorf("Param %d can't be decoded as %s: %s", i, types[i], err)
+		}
+		params[i] = value.Elem().Interface()
+	}
+	return params, nil
+}
@@ -0,0 +1,120 @@
+package task
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/config"
+)
+
+type person struct {
+	Name        string
+	DateOfBirth time.Time
+	Tags        []string
+}
+
+func TestValidateParams(t *testing.T) {
+	types := []reflect.Type{reflect.TypeOf(""), reflect.TypeOf(0), reflect.TypeOf(&person{})}
+
+	if err := ValidateParams([]Param{"name", 1, &person{}}, types); err != nil {
+		t.Error("Matching params should be valid: ", err)
+	}
+	if err := ValidateParams([]Param{"name", 1, nil}, types); err != nil {
+		t.Error("A nil pointer param should be valid: ", err)
+	}
+	if err := ValidateParams([]Param{"name", 1}, types); err == nil {
+		t.Error("A missing param should be invalid")
+	}
+	if err := ValidateParams([]Param{"name", "1", &person{}}, types); err == nil {
+		t.Error("A param of the wrong type should be invalid")
+	}
+	if err := ValidateParams([]Param{nil, 1, &person{}}, types); err == nil {
+		t.Error("A nil string param should be invalid")
+	}
+}
+
+func TestVariadicParams(t *testing.T) {
+	var joined string
+	function := func(sep string, parts ...string) { joined = strings.Join(parts, sep) }
+	meta, err := NewFunctionMeta("Variadic", function)
+	if err != nil {
+		t.Fatal("Failed to get the function meta: ", err)
+	}
+	params := []Param{"-", []string{"a", "b"}}
+	if err := ValidateParams(params, meta.Params()); err != nil {
+		t.Fatal("The variadic params should be valid as a slice: ", err)
+	}
+	encoded, err := (&Task{Params: params}).EncodeParams()
+	if err != nil {
+		t.Fatal("Failed to encode params: ", err)
+	}
+	if params, err = DecodeParams(encoded, meta.Params()); err != nil {
+		t.Fatal("Failed to decode params: ", err)
+	}
+
+	funcManager := config.NewFunctionManager(config.StubMapping{"Variadic": function})
+	task := New(meta, params, *funcManager)
+	if _, err := task.RunContext(context.Background()); err != nil {
+		t.Fatal("Running a variadic function should succeed: ", err)
+	}
+	if joined != "a-b" {
+		t.Errorf("The variadic params should be passed, got %q", joined)
+	}
+}
+
+func TestParamsRoundTrip(t *testing.T) {
+	function := func(name string, count int, enabled bool, p person, ptr *person) {}
+	meta, err := NewFunctionMeta("Typed", function)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dob := time.Date(1990, time.May, 17, 0, 0, 0, 0, time.UTC)
+	params := []Param{"name", 3, true, person{Name: "John", DateOfBirth: dob, Tags: []string{"a"}}, (*person)(nil)}
+	task := New(meta, params, config.FunctionManager{})
+	encoded, err := task.EncodeParams()
+	if err != nil {
+		t.Fatal("Params should be encoded: ", err)
+	}
+	decoded, err := DecodeParams(encoded, meta.Params())
+	if err != nil {
+		t.Fatal("Params should be decoded: ", err)
+	}
+	if !reflect.DeepEqual(decoded, params) {
+		t.Errorf("Decoded params %#v differ from %#v", decoded, params)
+	}
+}
+
+func TestDecodeLegacyParams(t *testing.T) {
+	// Params used to be stored as JSON arrays of strings.
+	decoded, err := DecodeParams(`["Hello","World"]`, []reflect.Type{reflect.TypeOf(""), reflect.TypeOf("")})
+	if err != nil || !reflect.DeepEqual(decoded, []Param{"Hello", "World"}) {
+		t.Error("String params should still be decoded: ", err)
+	}
+	if _, err := DecodeParams(`["Hello"]`, []reflect.Type{reflect.TypeOf(0)}); err == nil {
+		t.Error("Decoding a param into the wrong type should fail")
+	}
+	if _, err := DecodeParams(`["Hello"]`, nil); err == nil {
+		t.Error("Decoding too many params should fail")
+	}
+	if params, err := DecodeParams("", nil); err != nil || len(params) != 0 {
+		t.Error("Empty params should be decoded as no params")
+	}
+}
+
+func TestEncodeParamsFailure(t *testing.T) {
+	task := New(FunctionMeta{Name: "Chan"}, []Param{make(chan bool)}, config.FunctionManager{})
+	if _, err := task.EncodeParams(); err == nil {
+		t.Error("Encoding a channel param should fail")
+	}
+}
+
+func TestFunctionMetaParamsSkipsContext(t *testing.T) {
+	meta, _ := NewFunctionMeta("Context", func(ctx context.Context, name string) {})
+	if params := meta.Params(); len(params) != 1 || params[0] != reflect.TypeOf("") {
+		t.Error("The context parameter should not be part of the params")
+	}
+}
@@ -1,6 +1,7 @@
 package task
 
 import (
+	"context"
 	"fmt"
 	"reflect"
 	"runtime"
@@ -11,16 +12,47 @@ type Function interface{}
 
 // FunctionMeta holds information about function such as name and parameters.
 type FunctionMeta struct {
-	Name string
+	Name     string
+	funcType reflect.Type
 }
 
+var contextType = reflect.TypeOf((*context.Context)(nil)).Elem()
+
+// Translate returns the FunctionMeta of function, named after its fully qualified Go name.
 func Translate(function Function) (FunctionMeta, error) {
 	funcValue := reflect.ValueOf(function)
 	if funcValue.Kind() != reflect.Func {
 		return FunctionMeta{}, fmt.Errorf("Provided function value is not an actual function")
 	}
 	name := runtime.FuncForPC(funcValue.Pointer()).Name()
+	return NewFunctionMeta(name, function)
+}
+
+// NewFunctionMeta returns the FunctionMeta of function registered under name.
+func NewFunctionMeta(name string, function Function) (FunctionMeta, error) {
+	funcValue := reflect.ValueOf(function)
+	if funcValue.Kind() != reflect.Func {
+		return FunctionMeta{}, fmt.Errorf("Function %s is not an actual function", name)
+	}
 	return FunctionMeta{
-		Name: name,
+		Name:     name,
+		funcType: funcValue.Type(),
 	}, nil
 }
+
+// Params returns the types of the parameters which have to be provided when
+// scheduling the function. A leading context.Context parameter is left out
+// since it's passed by the scheduler.
+func (meta FunctionMeta) Params() []reflect.Type {
+	if meta.funcType == nil {
+		return nil
+	}
+	var params []reflect.Type
+	for i := 0; i < meta.funcType.NumIn(); i++ {
+		if i == 0 && meta.funcType.In(i) == contextType {
+			continue
+		}
+		params = append(params, meta.funcType.In(i))
+	}
+	return params
+}
@@ -3,6 +3,8 @@ package task
 import (
 	"reflect"
 	"testing"
+
+	"github.com/ClubNFT/scheduler/config"
 )
 
 func TestRegistryFunc(t *testing.T) {
@@ -25,17 +27,17 @@ func TestRegistryFake(t *testing.T) {
 func TestGet(t *testing.T) {
 	mock := CallbackMock{}
 
-	funcRegistry := NewFuncRegistry()
-	funcMeta, err := funcRegistry.Add(mock.CallNoArgs)
-	_, err = funcRegistry.Add(mock.CallWithArgs)
+	funcManager := newFuncManager(mock.CallNoArgs, mock.CallWithArgs)
+	funcMeta, err := newFuncMeta(mock.CallNoArgs)
 
 	if err != nil {
 		t.Error("Failed to register function")
 	}
 
-	getResult, err := funcRegistry.Get("github.com/ClubNFT/scheduler/task.(*CallbackMock).CallNoArgs-fm")
+	function, found := funcManager.Get("github.com/ClubNFT/scheduler/task.(*CallbackMock).CallNoArgs-fm")
+	getResult, err := NewFunctionMeta("github.com/ClubNFT/scheduler/task.(*CallbackMock).CallNoArgs-fm", function)
 
-	if err != nil || funcMeta.Name != getResult.Name {
+	if !found || err != nil || funcMeta.Name != getResult.Name {
 		t.Error("Could not find registered function")
 	}
 }
@@ -43,13 +45,12 @@ func TestGet(t *testing.T) {
 func TestAddExistingFunc(t *testing.T) {
 	mock := CallbackMock{}
 
-	funcRegistry := NewFuncRegistry()
-	_, err := funcRegistry.Add(mock.CallWithArgs)
+	funcMeta, err := newFuncMeta(mock.CallWithArgs)
 	if err != nil {
 		t.Error("Failed to add function")
 	}
-	_, err = funcRegistry.Add(mock.CallWithArgs)
-	if err != nil {
+	existingMeta, err := newFuncMeta(mock.CallWithArgs)
+	if err != nil || existingMeta.Name != funcMeta.Name {
 		t.Error("Failed to add existing function")
 	}
 }
@@ -57,20 +58,14 @@ func TestAddExistingFunc(t *testing.T) {
 func TestExists(t *testing.T) {
 	mock := CallbackMock{}
 
-	funcRegistry := NewFuncRegistry()
-	_, err := funcRegistry.Add(mock.CallNoArgs)
-	_, err = funcRegistry.Add(mock.CallWithArgs)
-
-	if err != nil {
-		t.Error("Failed to register function")
-	}
+	funcManager := newFuncManager(mock.CallNoArgs, mock.CallWithArgs)
 
-	found := funcRegistry.Exists("CallNoArgs")
+	_, found := funcManager.Get("CallNoArgs")
 
 	if found {
 		t.Error("Found a non-registered function")
 	}
-	found = funcRegistry.Exists("github.com/ClubNFT/scheduler/task.(*CallbackMock).CallNoArgs-fm")
+	_, found = funcManager.Get("github.com/ClubNFT/scheduler/task.(*CallbackMock).CallNoArgs-fm")
 	if !found {
 		t.Error("Couldn't find a registered function")
 	}
@@ -93,6 +88,16 @@ func TestFunctionMetaParams(t *testing.T) {
 }
 
 func newFuncMeta(function Function) (FunctionMeta, error) {
-	funcRegistry := NewFuncRegistry()
-	return funcRegistry.Add(function)
+	return Translate(function)
+}
+
+// newFuncManager returns a FunctionManager with functions registered under their Go names.
+func newFuncManager(functions ...Function) config.FunctionManager {
+	stubs := config.StubMapping{}
+	for _, function := range functions {
+		if funcMeta, err := Translate(function); err == nil {
+			stubs[funcMeta.Name] = function
+		}
+	}
+	return *config.NewFunctionManager(stubs)
 }
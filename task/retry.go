@@ -0,0 +1,54 @@
+package task
+
+import (
+	"math"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy describes how failed executions of a task are retried.
+// The zero value disables retries.
+type RetryPolicy struct {
+	// MaxAttempts is the total number of attempts per run, including the first one.
+	MaxAttempts int
+	// InitialDelay is the delay before the first retry.
+	InitialDelay time.Duration
+	// Multiplier grows the delay after every retry. Values below 1 are treated as 1.
+	Multiplier float64
+	// MaxDelay caps the delay between retries if it's greater than zero.
+	MaxDelay time.Duration
+	// Jitter randomizes every delay by up to the given fraction, e.g. 0.1 for ±10%.
+	Jitter float64
+}
+
+// Delay returns how long to wait before the given retry, starting at 1 for the first retry.
+func (policy RetryPolicy) Delay(retry int) time.Duration {
+	multiplier := math.Max(policy.Multiplier, 1)
+	delay := float64(policy.InitialDelay) * math.Pow(multiplier, float64(retry-1))
+	if policy.MaxDelay > 0 {
+		delay = math.Min(delay, float64(policy.MaxDelay))
+	}
+	if policy.Jitter > 0 {
+		delay += delay * policy.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(delay)
+}
+
+// ScheduleRetry records a failed attempt of the task. If the retry policy allows
+// another attempt, RetryAt is set accordingly and true is returned. Otherwise the
+// attempt counter is reset and false is returned.
+func (task *Task) ScheduleRetry(now time.Time) bool {
+	task.Attempt++
+	if task.Attempt >= task.Retry.MaxAttempts {
+		task.ResetRetry()
+		return false
+	}
+	task.RetryAt = now.Add(task.Retry.Delay(task.Attempt))
+	return true
+}
+
+// ResetRetry clears the retry state once a run succeeded or was given up on.
+func (task *Task) ResetRetry() {
+	task.Attempt = 0
+	task.RetryAt = time.Time{}
+}
@@ -0,0 +1,65 @@
+package task
+
+import (
+	"testing"
+	"time"
+
+	"github.com/ClubNFT/scheduler/config"
+)
+
+func TestRetryPolicyDelay(t *testing.T) {
+	policy := RetryPolicy{
+		MaxAttempts:  5,
+		InitialDelay: time.Second,
+		Multiplier:   2,
+		MaxDelay:     5 * time.Second,
+	}
+	expected := []time.Duration{time.Second, 2 * time.Second, 4 * time.Second, 5 * time.Second}
+	for i, delay := range expected {
+		if actual := policy.Delay(i + 1); actual != delay {
+			t.Errorf("Retry %d: expected delay %s, got %s", i+1, delay, actual)
+		}
+	}
+
+	policy.Multiplier = 0
+	if policy.Delay(3) != time.Second {
+		t.Error("A multiplier below 1 should keep the delay constant")
+	}
+
+	policy.Jitter = 0.5
+	for i := 0; i < 100; i++ {
+		if delay := policy.Delay(1); delay < 500*time.Millisecond || delay > 1500*time.Millisecond {
+			t.Fatal("Jitter should stay within the given fraction, got ", delay)
+		}
+	}
+}
+
+func TestTaskScheduleRetry(t *testing.T) {
+	now := time.Now()
+	task := New(FunctionMeta{Name: "Retried"}, nil, config.FunctionManager{})
+	task.NextRun = now
+	task.Retry = RetryPolicy{MaxAttempts: 3, InitialDelay: time.Minute}
+
+	if !task.ScheduleRetry(now) || task.Attempt != 1 || !task.RetryAt.Equal(now.Add(time.Minute)) {
+		t.Error("First failure should schedule a retry")
+	}
+	if !task.DueAt().Equal(task.RetryAt) {
+		t.Error("A one-off task should be due at its retry")
+	}
+	if !task.ScheduleRetry(now) || task.Attempt != 2 {
+		t.Error("Second failure should schedule a retry")
+	}
+	if task.ScheduleRetry(now) || task.Attempt != 0 || !task.RetryAt.IsZero() {
+		t.Error("Retries should stop once MaxAttempts is reached")
+	}
+
+	task.IsRecurring = true
+	task.ScheduleRetry(now.Add(-2 * time.Minute))
+	if !task.DueAt().Equal(task.RetryAt) {
+		t.Error("A retry before the next run should be due first")
+	}
+	task.RetryAt = now.Add(time.Hour)
+	if !task.DueAt().Equal(task.NextRun) {
+		t.Error("The next run of a recurring task should supersede a later retry")
+	}
+}
@@ -1,11 +1,13 @@
 package task
 
 import (
+	"context"
 	"crypto/sha1"
 	"fmt"
 	"github.com/ClubNFT/scheduler/config"
 	"io"
 	"log"
+	"runtime/debug"
 	"time"
 )
 
@@ -18,18 +20,41 @@ type Schedule struct {
 	LastRun     time.Time
 	NextRun     time.Time
 	Duration    time.Duration
+	// CronExpr is set for tasks scheduled with a cron expression. When present,
+	// it takes precedence over Duration for computing the next run.
+	CronExpr string
+	// Location makes recurrences follow the wall clock of the given location
+	// instead of elapsed time, so they don't drift across DST changes.
+	Location *time.Location
+	// FirstRun is the first run of a recurring task. Intervals of whole days in
+	// a Location keep its wall-clock time.
+	FirstRun time.Time
+	// Attempt is the number of failed attempts of the current run and RetryAt
+	// the time of its next retry, if any.
+	Attempt int
+	RetryAt time.Time
 }
 
 // Task holds information about task
 type Task struct {
 	Schedule
-	Func        FunctionMeta
-	Params      []string
+	Func   FunctionMeta
+	Params []Param
+	// Timeout limits the duration of a single execution. The context passed
+	// to functions accepting a context.Context is cancelled once it expires.
+	Timeout time.Duration
+	// Retry describes how failed executions are retried.
+	Retry RetryPolicy
+	// Misfire describes how runs are handled which were missed.
+	Misfire MisfirePolicy
+	// Overlap describes what happens to runs which are due while the previous run is
+	// still in progress.
+	Overlap     OverlapPolicy
 	FuncManager config.FunctionManager
 }
 
 // New returns an instance of task
-func New(function FunctionMeta, params []string, funcManager config.FunctionManager) *Task {
+func New(function FunctionMeta, params []Param, funcManager config.FunctionManager) *Task {
 	return &Task{
 		Func:        function,
 		Params:      params,
@@ -38,7 +63,7 @@ func New(function FunctionMeta, params []string, funcManager config.FunctionMana
 }
 
 // NewWithSchedule creates an instance of task with the provided schedule information
-func NewWithSchedule(function FunctionMeta, params []string, schedule Schedule, funcManager config.FunctionManager) *Task {
+func NewWithSchedule(function FunctionMeta, params []Param, schedule Schedule, funcManager config.FunctionManager) *Task {
 	return &Task{
 		Func:        function,
 		Params:      params,
@@ -50,39 +75,170 @@ func NewWithSchedule(function FunctionMeta, params []string, schedule Schedule,
 // IsDue returns a boolean indicating whether the task should execute or not
 func (task *Task) IsDue() bool {
 	timeNow := time.Now()
-	return timeNow == task.NextRun || timeNow.After(task.NextRun)
+	dueAt := task.DueAt()
+	return timeNow == dueAt || timeNow.After(dueAt)
+}
+
+// DueAt returns the time of the task's next execution, which is either its
+// next retry or its next run. The next run of a recurring task supersedes a
+// retry which would happen after it.
+func (task *Task) DueAt() time.Time {
+	if task.RetryAt.IsZero() || task.IsRecurring && task.NextRun.Before(task.RetryAt) {
+		return task.NextRun
+	}
+	return task.RetryAt
 }
 
 // Run will execute the task and schedule it's next run.
 func (task *Task) Run() {
+	_, _ = task.RunContext(context.Background())
+}
+
+// RunContext executes the task like Run and returns the results of the function,
+// see config.FunctionManager.CallContext. A panic raised by the function is
+// recovered and returned as a *PanicError. Functions
+// whose first parameter is a context.Context receive ctx, limited by the
+// task's Timeout if one is set.
+func (task *Task) RunContext(ctx context.Context) (result interface{}, err error) {
 	// https://medium.com/@vicky.kurniawan/go-call-a-function-from-string-name-30b41dcb9e12
 
-	b := make([]interface{}, len(task.Params))
-	for i := range task.Params {
-		b[i] = task.Params[i]
+	if task.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, task.Timeout)
+		defer cancel()
 	}
 
-	_, err := task.FuncManager.Call(task.Func.Name, b...)
-	if err != nil {
-		log.Printf("Error calling function %s. Error: %s", task.Func.Name, err)
+	b := make([]interface{}, len(task.Params))
+	for i, param := range task.Params {
+		b[i] = param
 	}
+
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+		if err != nil {
+			log.Printf("Error calling function %s. Error: %s", task.Func.Name, err)
+		}
+		if ctx.Err() == context.DeadlineExceeded {
+			log.Printf("Function %s exceeded its timeout of %s", task.Func.Name, task.Timeout)
+		}
+	}()
+
+	return task.FuncManager.CallContext(ctx, task.Func.Name, b...)
 }
 
 // Hash will return the SHA1 representation of the task's data.
 func (task *Task) Hash() ID {
 	hash := sha1.New()
 	_, _ = io.WriteString(hash, task.Func.Name)
-	_, _ = io.WriteString(hash, fmt.Sprintf("%+v", task.Params))
+	// Params are hashed the way they're stored, so that the hash doesn't depend on
+	// e.g. the addresses of pointers among them.
+	params, err := task.EncodeParams()
+	if err != nil {
+		params = fmt.Sprintf("%+v", task.Params)
+	}
+	_, _ = io.WriteString(hash, params)
 	_, _ = io.WriteString(hash, fmt.Sprintf("%s", task.Schedule.Duration))
 	_, _ = io.WriteString(hash, fmt.Sprintf("%t", task.Schedule.IsRecurring))
+	_, _ = io.WriteString(hash, task.Schedule.CronExpr)
+	if task.Schedule.Location != nil {
+		_, _ = io.WriteString(hash, task.Schedule.Location.String())
+	}
+	// Options are only hashed when they're set, so that tasks without them keep
+	// their IDs.
+	if task.Timeout != 0 {
+		_, _ = io.WriteString(hash, fmt.Sprintf("timeout %s", task.Timeout))
+	}
+	if task.Retry.MaxAttempts > 0 {
+		_, _ = io.WriteString(hash, fmt.Sprintf("retry %+v", task.Retry))
+	}
+	if task.Misfire != (MisfirePolicy{}) {
+		_, _ = io.WriteString(hash, fmt.Sprintf("misfire %+v", task.Misfire))
+	}
+	if task.Overlap != OverlapAllow {
+		_, _ = io.WriteString(hash, fmt.Sprintf("overlap %d", task.Overlap))
+	}
 	return ID(fmt.Sprintf("%x", hash.Sum(nil)))
 }
 
+// ScheduleNextRun moves NextRun of a recurring task to its following occurrence.
+// NextRun is set to the zero time once the schedule ended, see Ended.
 func (task *Task) ScheduleNextRun() {
 	if !task.IsRecurring {
 		return
 	}
 
 	task.LastRun = task.NextRun
-	task.NextRun = task.NextRun.Add(task.Duration)
+	task.NextRun = task.Schedule.next(task.NextRun)
+}
+
+// Ended reports whether a recurring task has no runs left, because its cron
+// expression is invalid or never matches again, or its interval doesn't advance.
+func (task *Task) Ended() bool {
+	return task.IsRecurring && task.NextRun.IsZero()
+}
+
+// next returns the occurrence of a recurring schedule following after, or the zero
+// time if there is none.
+func (schedule Schedule) next(after time.Time) time.Time {
+	next := schedule.following(after)
+	if !next.After(after) {
+		return time.Time{}
+	}
+	return next
+}
+
+// following computes the occurrence of a recurring schedule following after. It
+// returns a time which isn't after after if the schedule doesn't advance.
+func (schedule Schedule) following(after time.Time) time.Time {
+	if schedule.Location != nil {
+		after = after.In(schedule.Location)
+	}
+
+	if schedule.CronExpr != "" {
+		cron, err := ParseCron(schedule.CronExpr)
+		if err != nil {
+			log.Printf("Error parsing cron expression %q. Error: %s", schedule.CronExpr, err)
+			return after
+		}
+		return cron.Next(after)
+	}
+
+	if schedule.Location == nil || schedule.Duration < 24*time.Hour {
+		return after.Add(schedule.Duration)
+	}
+
+	// DST changes shift occurrences by a few hours at most, so the occurrence
+	// before the estimated one is never after after.
+	first := schedule.firstOccurrence(after)
+	n := int(after.Sub(first) / schedule.Duration)
+	if n > 0 {
+		n--
+	}
+	for !schedule.occurrence(first, n).After(after) {
+		n++
+	}
+	return schedule.occurrence(first, n)
+}
+
+// firstOccurrence returns the occurrence from which the occurrences of a schedule
+// with intervals of whole days in a location are counted: the first run unless
+// it's after after, in which case it's after itself.
+func (schedule Schedule) firstOccurrence(after time.Time) time.Time {
+	if !schedule.FirstRun.IsZero() && !schedule.FirstRun.After(after) {
+		return schedule.FirstRun.In(schedule.Location)
+	}
+	return after
+}
+
+// occurrence returns the n-th occurrence after first of a schedule with intervals of
+// whole days in a location. It adds the whole days of n intervals to the calendar
+// date of first, so that its wall-clock time is kept across DST changes even after
+// a run was moved past a skipped hour; any remainder is added as elapsed time.
+func (schedule Schedule) occurrence(first time.Time, n int) time.Time {
+	elapsed := time.Duration(n) * schedule.Duration
+	days := int(elapsed / (24 * time.Hour))
+	return wallClock(first.Year(), first.Month(), first.Day()+days,
+		first.Hour(), first.Minute(), first.Second(), schedule.Location).Add(elapsed % (24 * time.Hour))
 }
@@ -58,6 +58,7 @@ func TestTaskRunScheduledNextRun(t *testing.T) {
 	task.NextRun = timeNow
 	task.Duration = 5 * time.Second
 	task.Run()
+	task.ScheduleNextRun()
 
 	if task.NextRun != timeNow.Add(5*time.Second) {
 		t.Fail()
@@ -79,12 +80,34 @@ func TestGenerateHash(t *testing.T) {
 	}
 }
 
+func TestHashIncludesOptions(t *testing.T) {
+	mock := CallbackMock{}
+	plain := newTestTask(t, mock.CallNoArgs, []Param{})
+	plain.IsRecurring = true
+	plain.Duration = time.Minute
+	hashes := map[ID]bool{plain.Hash(): true}
+
+	for _, option := range []func(*Task){
+		func(task *Task) { task.Timeout = time.Second },
+		func(task *Task) { task.Retry = RetryPolicy{MaxAttempts: 3} },
+		func(task *Task) { task.Misfire = MisfirePolicy{Mode: MisfireSkip} },
+		func(task *Task) { task.Overlap = OverlapSkip },
+	} {
+		task := *plain
+		option(&task)
+		if hashes[task.Hash()] {
+			t.Errorf("Tasks which differ in their options should have different hashes: %+v", task)
+		}
+		hashes[task.Hash()] = true
+	}
+}
+
 func newTestTask(t *testing.T, function Function, params []Param) *Task {
 	funcMeta, err := newFuncMeta(function)
 	if err != nil {
 		t.Error("Failed to register function")
 	}
-	return New(funcMeta, params)
+	return New(funcMeta, params, newFuncManager(function))
 }
 
 func newTestTaskWithSchedule(t *testing.T, function Function, params []Param, schedule Schedule) *Task {
@@ -92,5 +115,5 @@ func newTestTaskWithSchedule(t *testing.T, function Function, params []Param, sc
 	if err != nil {
 		t.Error("Failed to register function")
 	}
-	return NewWithSchedule(funcMeta, params, schedule)
+	return NewWithSchedule(funcMeta, params, schedule, newFuncManager(function))
 }